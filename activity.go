@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxActivityDays bounds the range of one activity request.
+const maxActivityDays = 3660
+
+type activityDay struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// handleActivity serves GET /api/notes/activity?from=&to=&tz=: how many
+// notes were created on each day from from to to (YYYY-MM-DD, inclusive) in
+// time zone tz, days without notes included. The range defaults to the
+// year up to today. List filters such as tag and notebook apply.
+func handleActivity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	qs := r.URL.Query()
+	tz := qs.Get("tz")
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		apiError(w, "invalid tz", http.StatusBadRequest)
+		return
+	}
+	now := clock.Now().In(loc)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if v := qs.Get("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			apiError(w, "to must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.AddDate(-1, 0, 1)
+	if v := qs.Get("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			apiError(w, "from must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if from.After(to) || to.Sub(from) > maxActivityDays*24*time.Hour {
+		apiError(w, fmt.Sprintf("from must not be after to, nor more than %d days before it", maxActivityDays), http.StatusBadRequest)
+		return
+	}
+	where, err := listFilters(r)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fromArg := where.arg(from.Format("2006-01-02"))
+	toArg := where.arg(to.Format("2006-01-02"))
+	tzArg := where.arg(tz)
+	where.add("created_at >= (" + fromArg + "::date::timestamp AT TIME ZONE " + tzArg + ")")
+	where.add("created_at < ((" + toArg + "::date + 1)::timestamp AT TIME ZONE " + tzArg + ")")
+	query := `
+		WITH counts AS (
+			SELECT date_trunc('day', created_at AT TIME ZONE ` + tzArg + `)::date AS day, COUNT(*) AS n
+			FROM ` + notesTable + where.String() + ` GROUP BY 1
+		)
+		SELECT to_char(d, 'YYYY-MM-DD'), COALESCE(c.n, 0)
+		FROM generate_series(` + fromArg + `::date, ` + toArg + `::date, interval '1 day') d
+		LEFT JOIN counts c ON c.day = d::date
+		ORDER BY d`
+	defer observeQuery("activity", time.Now())
+	var out []activityDay
+	err = retry(func() error {
+		out = []activityDay{}
+		rows, err := db.Query(query, where.args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var d activityDay
+			if err := rows.Scan(&d.Date, &d.Count); err != nil {
+				return err
+			}
+			out = append(out, d)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var adminToken string
+
+// requireAdmin gates the /admin/ routes behind ADMIN_TOKEN, sent as a
+// bearer token or X-Admin-Token. Without ADMIN_TOKEN they do not exist.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			notFound(w, r)
+			return
+		}
+		if !isAdmin(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdmin reports whether r carries ADMIN_TOKEN.
+func isAdmin(r *http.Request) bool {
+	if adminToken == "" {
+		return false
+	}
+	tok := r.Header.Get("X-Admin-Token")
+	if tok == "" {
+		tok = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(tok), []byte(adminToken)) == 1
+}
+
+func adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/dedupe", heavy(handleAdminDedupe))
+	mux.HandleFunc("/admin/stats/reset", handleAdminStatsReset)
+	mux.HandleFunc("/admin/purge-trash", heavy(handlePurgeTrash))
+	mux.HandleFunc("/admin/audit", handleAudit)
+	mux.HandleFunc("/admin/reconcile-stats", heavy(handleReconcileStats))
+	mux.HandleFunc("/admin/db-pool", handleDBPool)
+	mux.HandleFunc("/admin/read-only", handleReadOnly)
+	return requireAdmin(mux)
+}
+
+// handleAdminDedupe deletes notes whose title and body exactly match an
+// older note, keeping the oldest copy. dry_run=true lists them instead.
+func handleAdminDedupe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	start := time.Now()
+	var ids []int64
+	dryRun := isDryRun(r)
+	err := dryRunTx(dryRun, func(tx *sql.Tx) error {
+		var err error
+		ids, err = collectDeleted(tx, logDeletes(`
+			DELETE FROM `+notesTable+` a USING `+notesTable+` b
+			WHERE a.title = b.title AND a.body = b.body AND a.id > b.id
+				AND a.deleted_at IS NULL AND b.deleted_at IS NULL
+			RETURNING a.id
+		`, 1), clock.Now())
+		if err != nil {
+			return err
+		}
+		return requestActor(r).audit(tx, "delete", ids...)
+	})
+	observeQuery("delete", start)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if dryRun {
+		writeJSON(w, http.StatusOK, map[string]any{"deleted": len(ids), "ids": ids, "dry_run": true})
+		return
+	}
+	if len(ids) > 0 {
+		notesChanged()
+	}
+	analyzeNotes("dedupe", len(ids))
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": len(ids)})
+}
+
+func handleAdminStatsReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resetMetrics()
+	writeJSON(w, http.StatusOK, map[string]bool{"reset": true})
+}
+
+// handleDBPool reports the connection pool statistics, to tell a saturated
+// or leaking pool from a slow database.
+func handleDBPool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st := db.Stats()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"max_open":              st.MaxOpenConnections,
+		"open":                  st.OpenConnections,
+		"in_use":                st.InUse,
+		"idle":                  st.Idle,
+		"wait_count":            st.WaitCount,
+		"wait_duration_seconds": st.WaitDuration.Seconds(),
+		"max_idle_closed":       st.MaxIdleClosed,
+		"max_idle_time_closed":  st.MaxIdleTimeClosed,
+		"max_lifetime_closed":   st.MaxLifetimeClosed,
+	})
+}
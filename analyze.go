@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// analyzeAfterBulk runs ANALYZE on the notes table after a bulk import or
+// delete touching at least analyzeMinRows notes (ANALYZE_AFTER_BULK,
+// ANALYZE_MIN_ROWS), so the planner does not wait for autovacuum to learn
+// about the change.
+var (
+	analyzeAfterBulk bool
+	analyzeMinRows   = 1000
+)
+
+var analyzing atomic.Bool
+
+// analyzeNotes queues ANALYZE once op has changed rows notes. A run already
+// pending covers the call.
+func analyzeNotes(op string, rows int) {
+	if !analyzeAfterBulk || rows < analyzeMinRows || !analyzing.CompareAndSwap(false, true) {
+		return
+	}
+	ok := jobs.enqueue("analyze", func(ctx context.Context) error {
+		defer analyzing.Store(false)
+		start := time.Now()
+		if _, err := db.ExecContext(ctx, "ANALYZE "+notesTable); err != nil {
+			return fmt.Errorf("analyze after %s: %w", op, err)
+		}
+		log.Printf("analyze: %s after %s of %d notes took %s", notesTable, op, rows, time.Since(start).Round(time.Millisecond))
+		return nil
+	})
+	if !ok {
+		analyzing.Store(false)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// latestAPIVersion is the response schema served when a client does not
+// ask for one.
+const latestAPIVersion = 2
+
+// v1NoteFields is the note schema of API version 1. Fields added since are
+// left out of v1 responses so older clients never see unexpected keys; add
+// new fields to projectable only.
+var v1NoteFields = []string{
+	"id", "title", "body", "tags", "pinned", "pin_position", "public",
+	"content_json", "created_at", "updated_at", "deleted_at",
+	"created_relative", "attachments", "warnings",
+}
+
+type apiVersionKey struct{}
+
+// requestedVersion reads the version parameter of an application/json
+// Accept entry, or else X-API-Version. It returns 0 when neither is given.
+func requestedVersion(r *http.Request) (int, bool) {
+	v := ""
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mt == "application/json" && params["version"] != "" {
+			v = params["version"]
+			break
+		}
+	}
+	if v == "" {
+		v = strings.TrimSpace(r.Header.Get("X-API-Version"))
+	}
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(v, "v"))
+	return n, err == nil && n >= 1 && n <= latestAPIVersion
+}
+
+// withAPIVersion resolves the response schema version for a request and
+// echoes it in X-API-Version. Unknown versions get 406.
+func withAPIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, ok := requestedVersion(r)
+		if !ok {
+			httpError(w, r, "unsupported API version (latest is "+strconv.Itoa(latestAPIVersion)+")", http.StatusNotAcceptable)
+			return
+		}
+		if v == 0 {
+			v = latestAPIVersion
+		}
+		w.Header().Set("X-API-Version", strconv.Itoa(v))
+		w.Header().Add("Vary", "Accept, X-API-Version")
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, v)))
+	})
+}
+
+func apiVersion(r *http.Request) int {
+	if v, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return v
+	}
+	return latestAPIVersion
+}
+
+// noteFields is the projection to apply to notes in the response to r:
+// the ?select= projection, limited to the fields of the requested version.
+// nil means every field.
+func noteFields(r *http.Request, fields []string) []string {
+	if apiVersion(r) >= 2 {
+		return fields
+	}
+	if fields == nil {
+		return v1NoteFields
+	}
+	var out []string
+	for _, f := range fields {
+		for _, v1 := range v1NoteFields {
+			if f == v1 {
+				out = append(out, f)
+			}
+		}
+	}
+	return out
+}
+
+// renderNotes prepares notes for a response to r. Every handler returning
+// notes goes through it or renderNote so versions are applied in one place.
+func renderNotes(r *http.Request, notes []Note, fields []string) (any, error) {
+	f := noteFields(r, fields)
+	if f == nil {
+		return notes, nil
+	}
+	return project(notes, f)
+}
+
+func renderNote(r *http.Request, n Note, fields []string) (any, error) {
+	f := noteFields(r, fields)
+	if f == nil {
+		return n, nil
+	}
+	p, err := project([]Note{n}, f)
+	if err != nil {
+		return nil, err
+	}
+	return p[0], nil
+}
+
+// writeNoteJSON writes n as rendered for r.
+func writeNoteJSON(w http.ResponseWriter, r *http.Request, status int, n Note) {
+	v, err := renderNote(r, n, nil)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, status, v)
+}
+
+// writeNotesJSON writes notes as rendered for r.
+func writeNotesJSON(w http.ResponseWriter, r *http.Request, status int, notes []Note) {
+	v, err := renderNotes(r, notes, nil)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, status, v)
+}
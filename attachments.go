@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// Attachment is file metadata returned with a note. DataBase64 is only
+// used on input and is never sent back.
+type Attachment struct {
+	ID          int64     `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	DataBase64  string    `json:"data_base64,omitempty"`
+}
+
+type attachmentData struct {
+	Attachment
+	data []byte
+}
+
+var maxAttachmentSize int64
+
+// maxAttachments caps the attachments sent with one note
+// (MAX_ATTACHMENTS); 0 disables the cap.
+var maxAttachments = 20
+
+var errAttachmentTooLarge = errors.New("attachment too large")
+
+// decodeAttachments validates and decodes base64 attachments from a request.
+func decodeAttachments(in []Attachment) ([]attachmentData, error) {
+	if maxAttachments > 0 && len(in) > maxAttachments {
+		return nil, fmt.Errorf("too many attachments (max %d)", maxAttachments)
+	}
+	out := make([]attachmentData, 0, len(in))
+	for i, a := range in {
+		if a.Filename == "" {
+			return nil, fmt.Errorf("attachments[%d]: filename required", i)
+		}
+		if int64(base64.StdEncoding.DecodedLen(len(a.DataBase64))) > maxAttachmentSize+2 {
+			return nil, fmt.Errorf("attachments[%d]: %w (max %d bytes)", i, errAttachmentTooLarge, maxAttachmentSize)
+		}
+		data, err := base64.StdEncoding.DecodeString(a.DataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("attachments[%d]: invalid base64: %v", i, err)
+		}
+		if int64(len(data)) > maxAttachmentSize {
+			return nil, fmt.Errorf("attachments[%d]: %w (max %d bytes)", i, errAttachmentTooLarge, maxAttachmentSize)
+		}
+		if a.ContentType == "" {
+			a.ContentType = http.DetectContentType(data)
+		}
+		a.DataBase64 = ""
+		a.Size = int64(len(data))
+		out = append(out, attachmentData{Attachment: a, data: data})
+	}
+	return out, nil
+}
+
+func attachmentStatus(err error) int {
+	if errors.Is(err, errAttachmentTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func saveAttachments(tx *sql.Tx, noteID int64, atts []attachmentData) error {
+	for _, a := range atts {
+		_, err := tx.Exec(`
+			INSERT INTO attachments (note_id, filename, content_type, size, data)
+			VALUES ($1, $2, $3, $4, $5)
+		`, noteID, a.Filename, a.ContentType, a.Size, a.data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func loadAttachments(q querier, noteID int64) ([]Attachment, error) {
+	rows, err := q.Query(`
+		SELECT id, filename, content_type, size, created_at
+		FROM attachments WHERE note_id = $1 ORDER BY id
+	`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// serveAttachment handles GET and HEAD /api/notes/{id}/attachments/{aid}.
+// http.ServeContent takes care of Range, If-Range and conditional
+// requests, so downloads can be resumed and media streamed.
+func serveAttachment(w http.ResponseWriter, r *http.Request, noteID, attID int64) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	start := time.Now()
+	var a attachmentData
+	err := retry(func() error {
+		return db.QueryRow(`
+			SELECT a.filename, a.content_type, a.created_at, a.data
+			FROM attachments a JOIN `+notesTable+` n ON n.id = a.note_id
+			WHERE a.id = $1 AND a.note_id = $2 AND n.deleted_at IS NULL
+		`, attID, noteID).Scan(&a.Filename, &a.ContentType, &a.CreatedAt, &a.data)
+	})
+	observeQuery("get", start)
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if a.ContentType != "" {
+		w.Header().Set("Content-Type", a.ContentType)
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, a.Filename, a.CreatedAt, bytes.NewReader(a.data))
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestDecodeAttachmentsCount(t *testing.T) {
+	saved := maxAttachments
+	defer func() { maxAttachments = saved }()
+	maxAttachments = 2
+	savedSize := maxAttachmentSize
+	defer func() { maxAttachmentSize = savedSize }()
+	maxAttachmentSize = 1 << 10
+
+	att := Attachment{Filename: "a.txt", DataBase64: base64.StdEncoding.EncodeToString([]byte("hi"))}
+	if _, err := decodeAttachments([]Attachment{att, att}); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	if _, err := decodeAttachments([]Attachment{att, att, att}); err == nil {
+		t.Error("one over the limit accepted")
+	}
+}
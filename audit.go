@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// auditEnabled records every note write in audit_log (AUDIT_LOG), in the
+// transaction making the change.
+var auditEnabled bool
+
+// actor identifies who made a change: "admin" for requests carrying the
+// admin token, "system" for background jobs, empty otherwise.
+type actor struct {
+	name string
+	ip   string
+}
+
+var systemActor = actor{name: "system"}
+
+func requestActor(r *http.Request) actor {
+	a := actor{ip: clientIP(r)}
+	if isAdmin(r) {
+		a.name = "admin"
+	}
+	return a
+}
+
+// audit records action on ids by a. It is a no-op unless auditEnabled.
+func (a actor) audit(tx *sql.Tx, action string, ids ...int64) error {
+	if !auditEnabled || len(ids) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO audit_log (at, actor, action, note_id, client_ip)
+		SELECT $1, NULLIF($2, ''), $3, id, NULLIF($4, '') FROM unnest($5::bigint[]) AS id
+	`, clock.Now(), a.name, action, a.ip, pq.Array(ids))
+	return err
+}
+
+// collectDeleted runs a logDeletes statement and returns the removed ids.
+func collectDeleted(tx *sql.Tx, stmt string, args ...any) ([]int64, error) {
+	rows, err := tx.Query(stmt+" RETURNING id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+type auditEntry struct {
+	ID       int64     `json:"id"`
+	At       time.Time `json:"at"`
+	Actor    *string   `json:"actor"`
+	Action   string    `json:"action"`
+	NoteID   int64     `json:"note_id"`
+	ClientIP *string   `json:"client_ip"`
+}
+
+// handleAudit serves GET /admin/audit, newest first, filtered by actor,
+// action, note_id and an RFC 3339 since/until range.
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	qs := r.URL.Query()
+	where := &whereClause{}
+	if v := qs.Get("actor"); v != "" {
+		where.add("actor = " + where.arg(v))
+	}
+	if v := qs.Get("action"); v != "" {
+		where.add("action = " + where.arg(v))
+	}
+	if v := qs.Get("note_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid note_id", http.StatusBadRequest)
+			return
+		}
+		where.add("note_id = " + where.arg(id))
+	}
+	for _, p := range []struct{ key, op string }{{"since", ">="}, {"until", "<"}} {
+		v := qs.Get(p.key)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, p.key+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		where.add("at " + p.op + " " + where.arg(t))
+	}
+	limit := queryInt(r, "limit", 100, 1, 1000)
+	entries := []auditEntry{}
+	err := retry(func() error {
+		entries = entries[:0]
+		rows, err := db.Query("SELECT id, at, actor, action, note_id, client_ip FROM audit_log"+where.String()+
+			" ORDER BY at DESC, id DESC LIMIT "+strconv.Itoa(limit), where.args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var e auditEntry
+			if err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.Action, &e.NoteID, &e.ClientIP); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
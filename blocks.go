@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var errInvalidContentJSON = errors.New("content_json must be valid JSON")
+
+// applyContentJSON validates structured content and, when present, replaces
+// the body with its plaintext rendering so search and previews keep working.
+func applyContentJSON(n *Note) error {
+	if len(n.ContentJSON) == 0 || string(n.ContentJSON) == "null" {
+		n.ContentJSON = nil
+		return nil
+	}
+	if !json.Valid(n.ContentJSON) {
+		return errInvalidContentJSON
+	}
+	n.Body = blocksPlaintext(n.ContentJSON)
+	return nil
+}
+
+// blocksPlaintext joins every string stored under a "text" key, in document
+// order. That covers the common block editor formats (Editor.js,
+// ProseMirror, Slate), which all keep visible text in "text" members.
+func blocksPlaintext(raw []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	var parts []string
+	var depthIsObject []bool
+	expectKey := false
+	takeNext := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case json.Delim:
+			takeNext = false
+			switch t {
+			case '{':
+				depthIsObject = append(depthIsObject, true)
+				expectKey = true
+				continue
+			case '[':
+				depthIsObject = append(depthIsObject, false)
+			case '}', ']':
+				depthIsObject = depthIsObject[:len(depthIsObject)-1]
+			}
+		case string:
+			if expectKey {
+				takeNext = t == "text"
+				expectKey = false
+				continue
+			}
+			if takeNext && strings.TrimSpace(t) != "" {
+				parts = append(parts, t)
+			}
+			takeNext = false
+		default:
+			takeNext = false
+		}
+		expectKey = len(depthIsObject) > 0 && depthIsObject[len(depthIsObject)-1]
+	}
+	return strings.Join(parts, "\n")
+}
+
+// nullableJSON converts raw JSON into a query parameter for a JSONB column.
+func nullableJSON(raw json.RawMessage) any {
+	if raw == nil {
+		return nil
+	}
+	return string(raw)
+}
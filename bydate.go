@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type dayNotes struct {
+	Date  string `json:"date"`
+	Notes any    `json:"notes"`
+	notes []Note
+}
+
+// dayScanner reads the leading day column of a by-date row before handing
+// the remaining columns to scanNote.
+type dayScanner struct {
+	rows rowScanner
+	day  *time.Time
+}
+
+func (d dayScanner) Scan(dest ...any) error {
+	return d.rows.Scan(append([]any{d.day}, dest...)...)
+}
+
+// handleNotesByDate serves GET /api/notes/by-date: notes grouped by the
+// calendar day they were created on in the tz time zone (default UTC),
+// newest day first. Pagination counts days, not notes: days (default 7)
+// and offset select which days are returned. List filters such as tag and
+// q apply as usual.
+func handleNotesByDate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	where, err := listFilters(r)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		tz = "UTC"
+	}
+	day := "(created_at AT TIME ZONE " + where.arg(tz) + ")::date"
+	limit := where.arg(queryInt(r, "days", 7, 1, maxPageSize))
+	offset := where.arg(queryInt(r, "offset", 0, 0, 1<<30))
+	query := `
+		WITH matched AS (SELECT ` + day + ` AS day, ` + noteColumns + ` FROM ` + notesTable + where.String() + `),
+		days AS (SELECT DISTINCT day FROM matched ORDER BY day DESC LIMIT ` + limit + ` OFFSET ` + offset + `)
+		SELECT day, ` + noteColumns + ` FROM matched WHERE day IN (SELECT day FROM days)
+		ORDER BY day DESC, created_at DESC, id DESC`
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	defer observeQuery("list", time.Now())
+	var out []dayNotes
+	err = retry(func() error {
+		out = []dayNotes{}
+		rows, err := db.QueryContext(ctx, query, where.args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var d time.Time
+			n, err := scanNote(dayScanner{rows, &d})
+			if err != nil {
+				return err
+			}
+			date := d.Format("2006-01-02")
+			if len(out) == 0 || out[len(out)-1].Date != date {
+				out = append(out, dayNotes{Date: date})
+			}
+			last := &out[len(out)-1]
+			last.notes = append(last.notes, n)
+		}
+		return rows.Err()
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "22023" {
+		apiError(w, "unknown time zone", http.StatusBadRequest)
+		return
+	}
+	for i := range out {
+		if err == nil {
+			out[i].Notes, err = renderNotes(r, out[i].notes, nil)
+		}
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// responseCache holds encoded list responses keyed by normalized query
+// string. Any write clears it; ttl bounds staleness from writes made by
+// other processes. It holds at most maxSize entries, evicting the oldest.
+type responseCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	maxSize int
+	gen     uint64
+	entries map[string]cacheEntry
+
+	hits, misses atomic.Int64
+}
+
+type cacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration, maxSize int) *responseCache {
+	return &responseCache{ttl: ttl, maxSize: maxSize, entries: map[string]cacheEntry{}}
+}
+
+// get returns the cached body for key and the current generation, which
+// must be passed back to put.
+func (c *responseCache) get(key string) ([]byte, uint64, bool) {
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	gen := c.gen
+	c.mu.RUnlock()
+	if ok && time.Now().Before(e.expires) {
+		c.hits.Add(1)
+		return e.body, gen, true
+	}
+	if ok {
+		c.mu.Lock()
+		// Another caller may have replaced it since the read lock was dropped.
+		if cur, still := c.entries[key]; still && !time.Now().Before(cur.expires) {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+	}
+	c.misses.Add(1)
+	return nil, gen, false
+}
+
+// put stores body unless the cache was invalidated since gen was read.
+func (c *responseCache) put(key string, gen uint64, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if _, ok := c.entries[key]; !ok && c.maxSize > 0 && len(c.entries) >= c.maxSize {
+		c.evictOldest()
+	}
+	c.entries[key] = cacheEntry{body: body, expires: time.Now().Add(c.ttl)}
+}
+
+// evictOldest drops the entry closest to expiry, which, as every entry
+// gets the same ttl, is the one stored first. Callers hold c.mu.
+func (c *responseCache) evictOldest() {
+	var oldest string
+	var at time.Time
+	for k, e := range c.entries {
+		if at.IsZero() || e.expires.Before(at) {
+			oldest, at = k, e.expires
+		}
+	}
+	delete(c.entries, oldest)
+}
+
+func (c *responseCache) invalidate() {
+	c.mu.Lock()
+	c.gen++
+	c.entries = map[string]cacheEntry{}
+	c.mu.Unlock()
+}
+
+// listCache is nil when LIST_CACHE=false.
+var listCache *responseCache
+
+// notesChanged must be called after every successful write to notes.
+func notesChanged() {
+	if listCache != nil {
+		listCache.invalidate()
+	}
+	if searchCache != nil {
+		searchCache.invalidate()
+	}
+	signalChange()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResponseCacheDropsExpired(t *testing.T) {
+	c := newResponseCache(time.Millisecond, 0)
+	_, gen, _ := c.get("a")
+	c.put("a", gen, []byte("x"))
+	time.Sleep(2 * time.Millisecond)
+	if _, _, ok := c.get("a"); ok {
+		t.Fatal("expired entry served")
+	}
+	if n := len(c.entries); n != 0 {
+		t.Errorf("%d entries after expired get, want 0", n)
+	}
+}
+
+func TestResponseCacheEvictsOldest(t *testing.T) {
+	c := newResponseCache(time.Minute, 2)
+	for _, k := range []string{"a", "b", "c"} {
+		_, gen, _ := c.get(k)
+		c.put(k, gen, []byte(k))
+		time.Sleep(time.Millisecond)
+	}
+	if _, _, ok := c.get("a"); ok {
+		t.Error("oldest entry not evicted")
+	}
+	for _, k := range []string{"b", "c"} {
+		if _, _, ok := c.get(k); !ok {
+			t.Errorf("entry %q evicted", k)
+		}
+	}
+	_, gen, _ := c.get("b")
+	c.put("b", gen, []byte("b2"))
+	if n := len(c.entries); n != 2 {
+		t.Errorf("%d entries after replacing one, want 2", n)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+// handleCapabilities serves GET /api/capabilities: the configured limits
+// and which optional features are active, so clients can adapt to the
+// server they talk to.
+func handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sorts := make([]string, 0, len(sortOrders))
+	for k := range sortOrders {
+		sorts = append(sorts, k)
+	}
+	sort.Strings(sorts)
+	// FEATURES flags go in first so they cannot mask what the server
+	// actually does; the computed flags below overwrite any of the same name.
+	features := map[string]bool{}
+	for f := range indexData.Features {
+		features[f] = true
+	}
+	for f, on := range map[string]bool{
+		"search":           true,
+		"full_text_search": fullTextSearch,
+		"trigram_suggest":  trigramSuggest,
+		"language_detect":  detectLanguage,
+		"read_only":        readOnly.Load(),
+		"attachments":      maxAttachmentSize > 0,
+		"admin_auth":       adminToken != "",
+		"csrf":             csrfEnabled,
+		"compression":      compressionEnabled,
+		"list_cache":       listCache != nil,
+		"search_cache":     searchCache != nil,
+		"audit_log":        auditEnabled,
+		"trash_purge":      trashRetention > 0,
+		"ndjson_import":    true,
+	} {
+		features[f] = on
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"version": version,
+		"limits": map[string]any{
+			"max_page_size":       maxPageSize,
+			"default_page_size":   defaultPageSize,
+			"max_title_length":    maxTitleLength,
+			"max_body_length":     maxBodyLength,
+			"soft_body_length":    softBodyLength,
+			"max_attachment_size": maxAttachmentSize,
+			"max_attachments":     maxAttachments,
+			"max_body_size":       maxBodySize,
+			"max_pins":            maxPins,
+			"max_tags":            maxTags,
+			"max_tag_length":      maxTagLength,
+			"max_batch_ids":       maxBatchIDs,
+			"import_batch_size":   importBatchSize,
+		},
+		"sorts":    sorts,
+		"features": features,
+	})
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCapabilitiesComputedFlagsWin(t *testing.T) {
+	saved := indexData.Features
+	defer func() { indexData.Features = saved }()
+	indexData.Features = map[string]bool{"read_only": true, "beta_ui": true}
+	readOnly.Store(false)
+
+	rec := httptest.NewRecorder()
+	handleCapabilities(rec, httptest.NewRequest(http.MethodGet, "/api/capabilities", nil))
+	var out struct {
+		Features map[string]bool `json:"features"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Features["read_only"] {
+		t.Error("FEATURES overrode the computed read_only flag")
+	}
+	if !out.Features["beta_ui"] {
+		t.Error("FEATURES flag missing")
+	}
+}
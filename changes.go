@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// logDeletes wraps a DELETE ... RETURNING id statement so that the removed
+// ids are recorded in deleted_notes, stamped with the time bound to
+// placeholder $n, for delta sync.
+func logDeletes(del string, n int) string {
+	return "WITH gone AS (" + del + ") INSERT INTO deleted_notes (id, deleted_at) SELECT id, $" +
+		strconv.Itoa(n) + "::timestamptz FROM gone"
+}
+
+// maxChangesWait caps the wait parameter of the changes endpoint
+// (CHANGES_MAX_WAIT).
+var maxChangesWait = time.Minute
+
+// changesWindow is how long a write may take between stamping updated_at
+// and committing and still be seen by a poll (CHANGES_WINDOW). Writes stamp
+// their rows with clock.Now() before they commit, so a cursor taken at
+// query time could pass over a row that commits just after; server_time
+// lags by this much instead. Notes written within the window come back on
+// the next poll too, so clients must apply changes idempotently.
+var changesWindow = 5 * time.Second
+
+var changeSignal = struct {
+	sync.Mutex
+	ch chan struct{}
+}{ch: make(chan struct{})}
+
+// nextChange returns a channel that is closed on the next write to notes.
+func nextChange() <-chan struct{} {
+	changeSignal.Lock()
+	defer changeSignal.Unlock()
+	return changeSignal.ch
+}
+
+// signalChange wakes every request waiting in nextChange.
+func signalChange() {
+	changeSignal.Lock()
+	defer changeSignal.Unlock()
+	close(changeSignal.ch)
+	changeSignal.ch = make(chan struct{})
+}
+
+// handleChanges serves GET /api/notes/changes?since=<RFC 3339> for delta
+// sync: notes created or updated after since, the ids of notes trashed or
+// deleted after since, and server_time to pass as since on the next poll.
+// server_time trails the query by changesWindow and never goes back past
+// since. With wait=<duration> (at most CHANGES_MAX_WAIT) an empty result is
+// held back until a note changes or the wait is over.
+func handleChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	since, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since"))
+	if err != nil {
+		apiError(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		wait, err = time.ParseDuration(v)
+		if err != nil || wait < 0 {
+			apiError(w, "wait must be a duration such as 30s", http.StatusBadRequest)
+			return
+		}
+		wait = min(wait, maxChangesWait)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		// Subscribed before querying so that a write landing between the
+		// query and the wait still wakes us.
+		changed := nextChange()
+		// Taken before querying, and set back by changesWindow, so that
+		// writes still committing are picked up by the next poll.
+		cursor := clock.Now().Add(-changesWindow)
+		if cursor.Before(since) {
+			cursor = since
+		}
+		notes, deleted, err := changesSince(since)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		if len(notes) == 0 && len(deleted) == 0 && wait > 0 {
+			select {
+			case <-changed:
+				continue
+			case <-r.Context().Done():
+				return
+			case <-timer.C:
+			}
+			// Nothing changed locally, but another instance may have
+			// written; this last query covers that.
+			wait = 0
+			continue
+		}
+		list, err := renderNotes(r, notes, nil)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"notes":       list,
+			"deleted":     deleted,
+			"server_time": cursor.UTC().Format(time.RFC3339Nano),
+		})
+		return
+	}
+}
+
+// changesSince returns the notes written and the ids of notes trashed or
+// deleted after since.
+func changesSince(since time.Time) ([]Note, []int64, error) {
+	defer observeQuery("list", time.Now())
+	notes, err := queryNotes("SELECT "+noteColumns+" FROM "+notesTable+
+		" WHERE updated_at > $1 AND deleted_at IS NULL ORDER BY updated_at, id", since)
+	if err != nil {
+		return nil, nil, err
+	}
+	deleted := []int64{}
+	err = retry(func() error {
+		deleted = deleted[:0]
+		rows, err := db.Query(`
+			SELECT id FROM `+notesTable+` WHERE deleted_at > $1
+			UNION
+			SELECT id FROM deleted_notes WHERE deleted_at > $1
+			ORDER BY id`, since)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			deleted = append(deleted, id)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return notes, deleted, nil
+}
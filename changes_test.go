@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestChangesCursorCoversLateCommits(t *testing.T) {
+	testDB(t)
+	poll := func(since string) (cursor string, ids []int64) {
+		t.Helper()
+		rec := doJSON(t, handleChanges, http.MethodGet, "/api/notes/changes?since="+url.QueryEscape(since), nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var out struct {
+			Notes      []Note `json:"notes"`
+			ServerTime string `json:"server_time"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range out.Notes {
+			ids = append(ids, n.ID)
+		}
+		return out.ServerTime, ids
+	}
+	start := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	cursor, _ := poll(start)
+	// Stamped before the poll above but committed after it, like a write
+	// whose transaction was still open.
+	late := createTestNote(t, Note{Title: "late", Body: "x"})
+	if _, err := db.Exec("UPDATE "+notesTable+" SET updated_at = $2 WHERE id = $1", late.ID, time.Now().Add(-changesWindow/2)); err != nil {
+		t.Fatal(err)
+	}
+	next, ids := poll(cursor)
+	if len(ids) != 1 || ids[0] != late.ID {
+		t.Errorf("next poll returned %v, want the late note %d", ids, late.ID)
+	}
+	before, _ := time.Parse(time.RFC3339Nano, cursor)
+	after, _ := time.Parse(time.RFC3339Nano, next)
+	if after.Before(before) {
+		t.Errorf("cursor went back from %s to %s", cursor, next)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "time"
+
+// Clock supplies the current time for anything persisted or compared
+// against stored timestamps, so tests can substitute a fixed clock.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+var clock Clock = realClock{}
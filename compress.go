@@ -0,0 +1,169 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	compressionEnabled = true
+	gzipLevel          = gzip.DefaultCompression
+	brotliLevel        = 5
+	zstdLevel          = 3
+)
+
+type encoder struct {
+	name string
+	pool sync.Pool
+}
+
+type resetWriter interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+// encoders lists supported encodings in order of preference when a client
+// weights several equally.
+var encoders []*encoder
+
+func setupCompression() {
+	newEncoder := func(name string, mk func() resetWriter) *encoder {
+		e := &encoder{name: name}
+		e.pool.New = func() any { return mk() }
+		return e
+	}
+	encoders = []*encoder{
+		newEncoder("br", func() resetWriter {
+			return brotli.NewWriterLevel(nil, brotliLevel)
+		}),
+		newEncoder("zstd", func() resetWriter {
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(zstdLevel)))
+			return w
+		}),
+		newEncoder("gzip", func() resetWriter {
+			w, err := gzip.NewWriterLevel(nil, gzipLevel)
+			if err != nil {
+				w = gzip.NewWriter(nil)
+			}
+			return w
+		}),
+	}
+}
+
+// negotiateEncoding picks the supported encoding with the highest q-value in
+// an Accept-Encoding header, or nil for identity.
+func negotiateEncoding(header string) *encoder {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		weights[strings.ToLower(name)] = q
+	}
+	var best *encoder
+	bestQ := 0.0
+	for _, e := range encoders {
+		q, ok := weights[e.name]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+// incompressible lists content types that are already compressed or are
+// streamed event by event.
+var incompressible = []string{"image/", "video/", "audio/", "application/zip", "application/gzip", "text/event-stream"}
+
+type compressWriter struct {
+	http.ResponseWriter
+	enc         *encoder
+	w           resetWriter
+	wroteHeader bool
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	h := c.Header()
+	// Ranged responses stay identity, and so must any full response that
+	// offers ranges, or a resumed download would mix the two encodings.
+	ok := code >= 200 && code != http.StatusNoContent && code != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" && h.Get("Accept-Ranges") == ""
+	for _, t := range incompressible {
+		if strings.HasPrefix(h.Get("Content-Type"), t) {
+			ok = false
+		}
+	}
+	if ok {
+		h.Set("Content-Encoding", c.enc.name)
+		h.Del("Content-Length")
+		c.w = c.enc.pool.Get().(resetWriter)
+		c.w.Reset(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		if c.Header().Get("Content-Type") == "" {
+			c.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.w != nil {
+		return c.w.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *compressWriter) Flush() {
+	if f, ok := c.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *compressWriter) close() {
+	if c.w != nil {
+		c.w.Close()
+		c.w.Reset(nil)
+		c.enc.pool.Put(c.w)
+	}
+}
+
+func compressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if enc == nil || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if debugLogging {
+			log.Printf("debug: %s %s encoding=%s", r.Method, r.URL.Path, enc.name)
+		}
+		cw := &compressWriter{ResponseWriter: w, enc: enc}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressSkipsRangeableResponses(t *testing.T) {
+	setupCompression()
+	content := strings.Repeat("attachment data ", 200)
+	h := compressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		http.ServeContent(w, r, "a.txt", time.Time{}, strings.NewReader(content))
+	}))
+	for _, rng := range []string{"", "bytes=100-199"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/notes/1/attachments/1", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+			t.Errorf("range %q: Content-Encoding %q, want identity", rng, enc)
+		}
+	}
+
+	plain := compressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(content))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/notes", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	plain.ServeHTTP(rec, req)
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Errorf("list response: Content-Encoding %q, want gzip", enc)
+	}
+}
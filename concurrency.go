@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxConcurrentPerIP caps in-flight requests per client address
+// (MAX_CONCURRENT_PER_IP); 0 disables the cap. Event streams and
+// long-polls for changes are exempt, as they mostly sit idle, and so are
+// the admin and pprof routes, which must stay reachable under load.
+var maxConcurrentPerIP = 10
+
+var (
+	inflightMu sync.Mutex
+	inflight   = map[string]int{}
+
+	concurrencyRejected atomic.Int64
+)
+
+func acquireSlot(ip string) bool {
+	inflightMu.Lock()
+	defer inflightMu.Unlock()
+	if inflight[ip] >= maxConcurrentPerIP {
+		return false
+	}
+	inflight[ip]++
+	return true
+}
+
+func releaseSlot(ip string) {
+	inflightMu.Lock()
+	defer inflightMu.Unlock()
+	if inflight[ip]--; inflight[ip] <= 0 {
+		delete(inflight, ip)
+	}
+}
+
+// limitConcurrency answers 429 to a client that already has
+// maxConcurrentPerIP requests in flight. It must run inside withClientIP.
+func limitConcurrency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if concurrencyExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := clientIP(r)
+		if !acquireSlot(ip) {
+			concurrencyRejected.Add(1)
+			w.Header().Set("Retry-After", "1")
+			httpError(w, r, "too many concurrent requests", http.StatusTooManyRequests)
+			return
+		}
+		defer releaseSlot(ip)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func concurrencyExempt(r *http.Request) bool {
+	p := r.URL.Path
+	return p == "/api/notes/events" || (p == "/api/notes/changes" && r.URL.Query().Get("wait") != "") ||
+		strings.HasPrefix(p, "/admin/") || strings.HasPrefix(p, "/debug/pprof/")
+}
+
+// heavyLimiter is a semaphore for bulk operations that hold long
+// transactions, so that they cannot take every pooled connection.
+type heavyLimiter struct {
+	slots    chan struct{}
+	wait     time.Duration
+	rejected atomic.Int64
+}
+
+// heavyOps admits MAX_HEAVY_OPS bulk operations at a time; 0 disables the
+// limit. Others queue for up to HEAVY_OP_WAIT before getting a 503.
+var heavyOps heavyLimiter
+
+func (l *heavyLimiter) configure(n int, wait time.Duration) {
+	l.slots = nil
+	if n > 0 {
+		l.slots = make(chan struct{}, n)
+	}
+	l.wait = wait
+}
+
+func (l *heavyLimiter) inFlight() int {
+	return len(l.slots)
+}
+
+// heavy wraps a bulk operation handler in heavyOps.
+func heavy(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if heavyOps.slots == nil {
+			h(w, r)
+			return
+		}
+		timer := time.NewTimer(heavyOps.wait)
+		defer timer.Stop()
+		select {
+		case heavyOps.slots <- struct{}{}:
+		case <-timer.C:
+			heavyOps.rejected.Add(1)
+			w.Header().Set("Retry-After", "5")
+			httpError(w, r, "too many bulk operations in progress", http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
+			return
+		}
+		defer func() { <-heavyOps.slots }()
+		h(w, r)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLimitConcurrencyExemptions(t *testing.T) {
+	saved := maxConcurrentPerIP
+	defer func() { maxConcurrentPerIP = saved }()
+	maxConcurrentPerIP = 1
+	ip := "192.0.2.1"
+	if !acquireSlot(ip) {
+		t.Fatal("could not take the only slot")
+	}
+	defer releaseSlot(ip)
+
+	h := withClientIP(limitConcurrency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/notes", http.StatusTooManyRequests},
+		{"/api/notes/events", http.StatusOK},
+		{"/api/notes/changes?wait=10s", http.StatusOK},
+		{"/admin/stats/reset", http.StatusOK},
+		{"/debug/pprof/heap", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var (
+	testDBOnce sync.Once
+	testDBErr  error
+)
+
+// testDB connects to the scratch database named by TEST_DATABASE_URL and
+// empties it; tests needing Postgres are skipped without one. Every table
+// the app owns is truncated, so never point it at real data.
+func testDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	testDBOnce.Do(func() {
+		db, testDBErr = sql.Open("postgres", dsn)
+		if testDBErr == nil {
+			testDBErr = db.Ping()
+		}
+		if testDBErr == nil {
+			initDB()
+		}
+	})
+	if testDBErr != nil {
+		t.Fatalf("test database: %v", testDBErr)
+	}
+	_, err := db.Exec("TRUNCATE " + notesTable + ", note_links, attachments, deleted_notes, audit_log, note_revisions, notebooks, saved_views RESTART IDENTITY CASCADE")
+	if err == nil {
+		err = reconcileStats()
+	}
+	if err != nil {
+		t.Fatalf("resetting test database: %v", err)
+	}
+}
+
+// createTestNote stores n as a create request would.
+func createTestNote(t *testing.T, n Note) Note {
+	t.Helper()
+	atts, err := prepareNote(&n)
+	if err != nil {
+		t.Fatalf("prepareNote: %v", err)
+	}
+	var out Note
+	err = withTx(func(tx *sql.Tx) error {
+		out, err = insertNote(tx, n, atts)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("insertNote: %v", err)
+	}
+	return out
+}
+
+// doJSON calls h with v as a JSON request body.
+func doJSON(t *testing.T, h http.HandlerFunc, method, target string, v any) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	if v != nil {
+		if err := json.NewEncoder(&body).Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &body)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func countNotes(t *testing.T, where string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM "+notesTable+" WHERE "+where, args...).Scan(&n); err != nil {
+		t.Fatalf("counting notes: %v", err)
+	}
+	return n
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	testDB(t)
+	errSecond := errors.New("second statement")
+	err := withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO " + notesTable + " (title, body) VALUES ('first', 'x')"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("SELECT 1 / 0"); err != nil {
+			return errors.Join(errSecond, err)
+		}
+		return nil
+	})
+	if !errors.Is(err, errSecond) {
+		t.Fatalf("withTx error = %v, want the failing statement's", err)
+	}
+	if n := countNotes(t, "title = 'first'"); n != 0 {
+		t.Errorf("first statement committed: %d rows", n)
+	}
+}
+
+func TestWithTxRollsBackOnPanic(t *testing.T) {
+	testDB(t)
+	func() {
+		defer func() { recover() }()
+		withTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec("INSERT INTO " + notesTable + " (title, body) VALUES ('first', 'x')"); err != nil {
+				return err
+			}
+			panic("mid-operation")
+		})
+	}()
+	if n := countNotes(t, "title = 'first'"); n != 0 {
+		t.Errorf("insert before the panic committed: %d rows", n)
+	}
+}
+
+func TestWithTxCommits(t *testing.T) {
+	testDB(t)
+	err := withTx(func(tx *sql.Tx) error {
+		for _, title := range []string{"one", "two"} {
+			if _, err := tx.Exec("INSERT INTO "+notesTable+" (title, body) VALUES ($1, 'x')", title); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countNotes(t, "title IN ('one', 'two')"); n != 2 {
+		t.Errorf("committed %d rows, want 2", n)
+	}
+}
+
+func TestBulkTagRollsBackOnLimit(t *testing.T) {
+	testDB(t)
+	full := make([]string, maxTags)
+	for i := range full {
+		full[i] = "t" + string(rune('a'+i))
+	}
+	a := createTestNote(t, Note{Title: "a", Body: "x"})
+	b := createTestNote(t, Note{Title: "b", Body: "x", Tags: full})
+	rec := doJSON(t, handleBulkTag, "POST", "/api/notes/bulk-tag", map[string]any{"ids": []int64{a.ID, b.ID}, "add": []string{"new"}})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422; body %s", rec.Code, rec.Body)
+	}
+	if n := countNotes(t, "'new' = ANY(tags)"); n != 0 {
+		t.Errorf("%d notes kept the tag after the rejected bulk add", n)
+	}
+}
+
+// failUpdates makes the database reject, in mid-statement, any update of
+// a note that matches cond, a condition on NEW.
+func failUpdates(t *testing.T, cond string) {
+	t.Helper()
+	stmts := []string{
+		`CREATE OR REPLACE FUNCTION test_fail_update() RETURNS trigger AS $$
+		BEGIN RAISE EXCEPTION 'injected failure'; END $$ LANGUAGE plpgsql`,
+		"CREATE TRIGGER test_fail_update BEFORE UPDATE ON " + notesTable +
+			" FOR EACH ROW WHEN (" + cond + ") EXECUTE FUNCTION test_fail_update()",
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP TRIGGER IF EXISTS test_fail_update ON " + notesTable)
+		db.Exec("DROP FUNCTION IF EXISTS test_fail_update()")
+	})
+}
+
+func TestImportBatchRollsBackMidway(t *testing.T) {
+	testDB(t)
+	body := `{"title": "one", "body": "x"}
+{"title": "two", "body": "x"}
+{"title": "three", "body": "x", "notebook_id": 999999}
+`
+	req := httptest.NewRequest("POST", "/api/notes/import-ndjson?batch_size=10", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handleImportNDJSON(rec, req)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	var p importProgress
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Error == "" || p.Imported != 0 {
+		t.Errorf("progress = %+v, want an error and nothing imported", p)
+	}
+	if n := countNotes(t, "true"); n != 0 {
+		t.Errorf("%d notes committed by the failed batch, want 0", n)
+	}
+}
+
+func TestBulkTagRollsBackMidway(t *testing.T) {
+	testDB(t)
+	a := createTestNote(t, Note{Title: "a", Body: "x"})
+	b := createTestNote(t, Note{Title: "b", Body: "x"})
+	// The first tag goes onto both notes; the second fails on the last id.
+	failUpdates(t, "NEW.id = "+strconv.FormatInt(b.ID, 10)+" AND 'second' = ANY(NEW.tags)")
+	rec := doJSON(t, handleBulkTag, "POST", "/api/notes/bulk-tag", map[string]any{
+		"ids": []int64{a.ID, b.ID}, "add": []string{"first", "second"},
+	})
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+	if n := countNotes(t, "'first' = ANY(tags) OR 'second' = ANY(tags)"); n != 0 {
+		t.Errorf("%d notes kept tags from the failed bulk add", n)
+	}
+}
+
+func TestMergeRollsBackMidway(t *testing.T) {
+	testDB(t)
+	primary := createTestNote(t, Note{Title: "primary", Body: strings.Repeat("p", 60)})
+	secondary := createTestNote(t, Note{Title: "secondary", Body: strings.Repeat("s", 60)})
+	// The secondary is trashed before the merged body fails validation.
+	saved := maxBodyLength
+	defer func() { maxBodyLength = saved }()
+	maxBodyLength = 100
+	rec := doJSON(t, handleMerge, "POST", "/api/notes/merge", map[string]any{
+		"primary": primary.ID, "secondary": secondary.ID, "trash_secondary": true,
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422; body %s", rec.Code, rec.Body)
+	}
+	if n := countNotes(t, "id = $1 AND deleted_at IS NULL", secondary.ID); n != 1 {
+		t.Error("secondary stayed trashed after the failed merge")
+	}
+	if n := countNotes(t, "id = $1 AND body = $2", primary.ID, primary.Body); n != 1 {
+		t.Error("primary changed by the failed merge")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var dbHealthy atomic.Bool
+
+// isConnError reports whether err means the database connection was lost,
+// as opposed to a problem with the query itself. A deadline or cancellation
+// is not one: context.DeadlineExceeded satisfies net.Error, but retrying
+// under the same context cannot succeed.
+func isConnError(err error) bool {
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		return strings.HasPrefix(code, "08") || code == "57P01" || code == "57P02" || code == "57P03"
+	}
+	return false
+}
+
+// retry runs fn again once if it failed with a connection error. database/sql
+// replaces broken pooled connections, so the second attempt usually gets a
+// fresh one. fn must be safe to repeat.
+func retry(fn func() error) error {
+	err := fn()
+	if isConnError(err) {
+		err = fn()
+	}
+	return err
+}
+
+// serverError reports a failed database operation as an apiError: 503 when
+// the database is unreachable, 500 otherwise.
+func serverError(w http.ResponseWriter, err error) {
+	if isConnError(err) {
+		apiError(w, "database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("error: %v req=%s", err, responseRequestID(w))
+	apiError(w, err.Error(), http.StatusInternalServerError)
+}
+
+// watchDB pings the database periodically and logs transitions between
+// reachable and unreachable.
+func watchDB(interval time.Duration) {
+	dbHealthy.Store(true)
+	for range time.Tick(interval) {
+		err := db.Ping()
+		switch {
+		case err != nil && dbHealthy.Swap(false):
+			log.Println("database connection lost:", err)
+		case err == nil && !dbHealthy.Swap(true):
+			log.Println("database connection restored")
+		}
+	}
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if !dbHealthy.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "unavailable", "read_only": readOnly.Load()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "read_only": readOnly.Load()})
+}
+
+// beginTx starts a transaction, retrying once on a connection error.
+func beginTx() (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := retry(func() error {
+		var err error
+		tx, err = db.Begin()
+		return err
+	})
+	return tx, err
+}
+
+// withTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise, including when fn panics. fn must not commit itself.
+func withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := beginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+var errDryRun = errors.New("dry run")
+
+// dryRunTx is withTx, except that with dryRun set it rolls back even when
+// fn succeeds, so destructive operations can report what they would do.
+func dryRunTx(dryRun bool, fn func(tx *sql.Tx) error) error {
+	err := withTx(func(tx *sql.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		return nil
+	}
+	return err
+}
+
+func isDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dry_run") == "true"
+}
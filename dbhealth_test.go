@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestIsConnError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"bad conn", driver.ErrBadConn, true},
+		{"eof", fmt.Errorf("read: %w", io.EOF), true},
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"syntax error", &pq.Error{Code: "42601"}, false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"wrapped deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), false},
+		{"canceled", context.Canceled, false},
+		{"other", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := isConnError(tt.err); got != tt.want {
+			t.Errorf("%s: isConnError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryStopsAtDeadline(t *testing.T) {
+	calls := 0
+	err := retry(func() error {
+		calls++
+		return context.DeadlineExceeded
+	})
+	if calls != 1 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("retry ran %d times with %v, want once with the deadline", calls, err)
+	}
+}
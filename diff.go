@@ -0,0 +1,185 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+)
+
+const (
+	diffContext  = 3
+	maxDiffLines = 2000
+)
+
+type diffLine struct {
+	Op   string `json:"op"` // " ", "-" or "+"
+	Text string `json:"text"`
+}
+
+type diffHunk struct {
+	AStart int        `json:"a_start"`
+	ALines int        `json:"a_lines"`
+	BStart int        `json:"b_start"`
+	BLines int        `json:"b_lines"`
+	Lines  []diffLine `json:"lines"`
+}
+
+type noteDiff struct {
+	A            int64      `json:"a"`
+	B            int64      `json:"b"`
+	TitleChanged bool       `json:"title_changed"`
+	TitleA       string     `json:"title_a,omitempty"`
+	TitleB       string     `json:"title_b,omitempty"`
+	Hunks        []diffHunk `json:"hunks"`
+}
+
+// handleDiff returns a line diff of the bodies of notes a and b, each given
+// by integer id or UUID.
+func handleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	aKey, errA := parseNoteKey(r.URL.Query().Get("a"))
+	bKey, errB := parseNoteKey(r.URL.Query().Get("b"))
+	if errA != nil || errB != nil {
+		apiError(w, "a and b must be note ids", http.StatusBadRequest)
+		return
+	}
+	ids, err := resolveNoteKeys([]noteKey{aKey, bKey})
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	aID, bID := ids[0], ids[1]
+	var a, b Note
+	err = retry(func() error {
+		var err error
+		if a, err = scanNote(db.QueryRow("SELECT "+noteColumns+" FROM "+notesTable+" WHERE id = $1 AND deleted_at IS NULL", aID)); err != nil {
+			return err
+		}
+		b, err = scanNote(db.QueryRow("SELECT "+noteColumns+" FROM "+notesTable+" WHERE id = $1 AND deleted_at IS NULL", bID))
+		return err
+	})
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	al, bl := splitLines(a.Body), splitLines(b.Body)
+	if len(al) > maxDiffLines || len(bl) > maxDiffLines {
+		apiError(w, "notes too long to diff", http.StatusUnprocessableEntity)
+		return
+	}
+	d := noteDiff{A: a.ID, B: b.ID, Hunks: diffHunks(al, bl)}
+	if a.Title != b.Title {
+		d.TitleChanged = true
+		d.TitleA, d.TitleB = a.Title, b.Title
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes an edit script from a to b using the longest common
+// subsequence of lines.
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, diffLine{" ", a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, diffLine{"-", a[i]})
+			i++
+		default:
+			out = append(out, diffLine{"+", b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, diffLine{"-", a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, diffLine{"+", b[j]})
+	}
+	return out
+}
+
+// diffHunks groups changes into unified-diff style hunks with up to
+// diffContext unchanged lines around them. Line numbers are 1-based.
+func diffHunks(a, b []string) []diffHunk {
+	lines := diffLines(a, b)
+	hunks := []diffHunk{}
+	// aPos[k] and bPos[k] are the line numbers of lines[k] in a and b.
+	aPos, bPos := make([]int, len(lines)), make([]int, len(lines))
+	ai, bi := 1, 1
+	for k, l := range lines {
+		aPos[k], bPos[k] = ai, bi
+		if l.Op != "+" {
+			ai++
+		}
+		if l.Op != "-" {
+			bi++
+		}
+	}
+	for k := 0; k < len(lines); {
+		if lines[k].Op == " " {
+			k++
+			continue
+		}
+		from := max(0, k-diffContext)
+		end := k
+		// Extend while the next change is close enough to share context.
+		for end < len(lines) {
+			next := end
+			for next < len(lines) && lines[next].Op == " " {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContext {
+				break
+			}
+			for next < len(lines) && lines[next].Op != " " {
+				next++
+			}
+			end = next
+		}
+		to := min(len(lines), end+diffContext)
+		h := diffHunk{AStart: aPos[from], BStart: bPos[from], Lines: lines[from:to]}
+		for _, l := range h.Lines {
+			if l.Op != "+" {
+				h.ALines++
+			}
+			if l.Op != "-" {
+				h.BLines++
+			}
+		}
+		hunks = append(hunks, h)
+		k = to
+	}
+	return hunks
+}
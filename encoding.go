@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// replaceInvalidUTF8 swaps invalid byte sequences for U+FFFD instead of
+	// rejecting the note. encoding/json makes the same swap while decoding,
+	// so JSON bodies are checked with checkUTF8Body before they are decoded.
+	replaceInvalidUTF8 bool
+	normalizeNFC       = true
+	// stripControlChars drops NUL and other control characters, which
+	// Postgres rejects in text or which garble rendering. Tabs and line
+	// breaks are kept.
+	stripControlChars = true
+	// binaryBodyRatio is the share of control characters and invalid
+	// bytes past which a body is rejected as binary data
+	// (BINARY_BODY_RATIO); 0 disables the check.
+	binaryBodyRatio = 0.3
+	// titleFromHeading fills an empty title from a leading Markdown H1 in
+	// the body (TITLE_FROM_HEADING).
+	titleFromHeading bool
+)
+
+var errInvalidUTF8 = errors.New("title, body and tags must be valid UTF-8")
+
+// checkUTF8Body buffers r.Body and fails with errInvalidUTF8 if it is not
+// valid UTF-8, unless replaceInvalidUTF8 is set. The body should already be
+// capped by limitBody.
+func checkUTF8Body(r *http.Request) error {
+	if replaceInvalidUTF8 {
+		return nil
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	if !utf8.Valid(b) {
+		return errInvalidUTF8
+	}
+	return nil
+}
+
+// normalizeText checks the encoding of a note's text fields, strips control
+// characters and brings them into NFC so that search and duplicate
+// detection compare like with like. Tags are also trimmed, folded and
+// deduplicated, and the language is filled in.
+func normalizeText(n *Note) error {
+	// Checked first: stripping control characters would hide them.
+	if looksBinary(n.Body) {
+		return validationErrors{"body": "looks like binary data"}
+	}
+	fields := []*string{&n.Title, &n.Body}
+	for i := range n.Tags {
+		fields = append(fields, &n.Tags[i])
+	}
+	for _, f := range fields {
+		if !utf8.ValidString(*f) {
+			if !replaceInvalidUTF8 {
+				return errInvalidUTF8
+			}
+			*f = strings.ToValidUTF8(*f, "\uFFFD")
+		}
+		if stripControlChars {
+			*f = strings.Map(dropControl, *f)
+		}
+		if normalizeNFC {
+			*f = norm.NFC.String(*f)
+		}
+	}
+	n.Tags = uniqueTags(n.Tags)
+	normalizeLanguage(n)
+	normalizeFormat(n)
+	if titleFromHeading && strings.TrimSpace(n.Title) == "" {
+		n.Title = headingTitle(n.Body)
+	}
+	return nil
+}
+
+// headingTitle returns the text of body's first line if it is an ATX H1
+// ("# Title", optionally closed by trailing #s), or "" otherwise. Leading
+// blank lines are skipped. The result is cut to maxTitleLength.
+func headingTitle(body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		rest, ok := strings.CutPrefix(line, "#")
+		if !ok || rest == "" || (rest[0] != ' ' && rest[0] != '\t') {
+			return ""
+		}
+		rest = strings.TrimSpace(rest)
+		if t := strings.TrimRight(rest, "#"); t != rest && (t == "" || strings.HasSuffix(t, " ") || strings.HasSuffix(t, "\t")) {
+			rest = strings.TrimSpace(t)
+		}
+		return truncateRunes(rest, maxTitleLength)
+	}
+	return ""
+}
+
+// looksBinary reports whether more than binaryBodyRatio of s is control
+// characters other than whitespace, or bytes that are not UTF-8.
+func looksBinary(s string) bool {
+	if binaryBodyRatio <= 0 || s == "" {
+		return false
+	}
+	bad, total := 0, 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		total++
+		if (r == utf8.RuneError && size == 1) || (dropControl(r) == -1 && r != '\f') {
+			bad++
+		}
+	}
+	return float64(bad) > binaryBodyRatio*float64(total)
+}
+
+// dropControl is a strings.Map function removing C0 and C1 control
+// characters other than tab, newline and carriage return.
+func dropControl(r rune) rune {
+	switch {
+	case r == '\t' || r == '\n' || r == '\r':
+		return r
+	case r < 0x20 || (r >= 0x7f && r <= 0x9f):
+		return -1
+	}
+	return r
+}
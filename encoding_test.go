@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDropControl(t *testing.T) {
+	keep := []rune{'\t', '\n', '\r', ' ', 'a', '\u00e9', '\u00a0', '\u200b', '\U0001F600'}
+	drop := []rune{0x00, 0x01, 0x07, 0x08, 0x0b, 0x0c, 0x1b, 0x1f, 0x7f, 0x80, 0x85, 0x9b, 0x9f}
+	for _, r := range keep {
+		if dropControl(r) != r {
+			t.Errorf("dropControl(%U) dropped it", r)
+		}
+	}
+	for _, r := range drop {
+		if dropControl(r) != -1 {
+			t.Errorf("dropControl(%U) kept it", r)
+		}
+	}
+}
+
+func TestNormalizeTextStripsControls(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"embedded null", "be\x00fore", "before"},
+		{"leading and trailing nulls", "\x00\x00text\x00", "text"},
+		{"whitespace kept", "one\r\n\ttwo\n", "one\r\n\ttwo\n"},
+		{"ANSI color codes", "\x1b[31mred\x1b[0m text", "[31mred[0m text"},
+		{"bell and backspace", "ding\a\b!", "ding!"},
+		{"C1 CSI and NEL", "a\u009b2Jb\u0085c", "a2Jbc"},
+		{"DEL", "x\x7fy", "xy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := Note{Title: tt.in, Body: tt.in + " body", Tags: []string{"t" + tt.in}}
+			if err := normalizeText(&n); err != nil {
+				t.Fatalf("normalizeText: %v", err)
+			}
+			if n.Title != tt.want {
+				t.Errorf("title = %q, want %q", n.Title, tt.want)
+			}
+			if n.Body != tt.want+" body" {
+				t.Errorf("body = %q, want %q", n.Body, tt.want+" body")
+			}
+			if len(n.Tags) != 1 || strings.ContainsAny(n.Tags[0], "\x00\x1b\x7f\u009b") {
+				t.Errorf("tags = %q, want control characters removed", n.Tags)
+			}
+		})
+	}
+}
+
+func TestNormalizeTextKeepsControlsWhenDisabled(t *testing.T) {
+	defer func(v bool) { stripControlChars = v }(stripControlChars)
+	stripControlChars = false
+	n := Note{Title: "a\x1bb", Body: "some text\x00with a null"}
+	if err := normalizeText(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Title != "a\x1bb" || n.Body != "some text\x00with a null" {
+		t.Errorf("got title %q body %q, want them unchanged", n.Title, n.Body)
+	}
+}
+
+func TestNormalizeTextRejectsBinary(t *testing.T) {
+	n := Note{Title: "blob", Body: "\x00\x01\x02\x03PNG\x00\x00\x00"}
+	err := normalizeText(&n)
+	if errs, ok := err.(validationErrors); !ok || errs["body"] == "" {
+		t.Errorf("normalizeText = %v, want a body validation error", err)
+	}
+}
+
+func TestCheckUTF8Body(t *testing.T) {
+	body := "{\"title\": \"caf\xe9\", \"body\": \"x\"}"
+	for _, replace := range []bool{false, true} {
+		saved := replaceInvalidUTF8
+		replaceInvalidUTF8 = replace
+		r := httptest.NewRequest(http.MethodPost, "/api/notes", strings.NewReader(body))
+		err := checkUTF8Body(r)
+		replaceInvalidUTF8 = saved
+		if (err != nil) != !replace {
+			t.Errorf("replace=%v: err = %v", replace, err)
+		}
+		if rest, _ := io.ReadAll(r.Body); string(rest) != body {
+			t.Errorf("replace=%v: body after check = %q", replace, rest)
+		}
+	}
+}
+
+func TestSaveNoteRejectsInvalidUTF8JSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/notes", strings.NewReader("{\"title\": \"caf\xe9\", \"body\": \"x\"}"))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handleNotes(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var debugLogging bool
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// loadConfig reads settings from the environment, exiting on invalid values
+// before anything else starts.
+func loadConfig() {
+	slowQueryThreshold = envDuration("SLOW_QUERY_THRESHOLD", 200*time.Millisecond)
+	maxAttachmentSize = int64(envInt("MAX_ATTACHMENT_SIZE", 10<<20))
+	maxAttachments = envInt("MAX_ATTACHMENTS", maxAttachments)
+	maxBodySize = int64(envInt("MAX_BODY_SIZE", int(maxBodySize)))
+	maxPageSize = envInt("MAX_PAGE_SIZE", maxPageSize)
+	defaultPageSize = min(envInt("DEFAULT_PAGE_SIZE", defaultPageSize), maxPageSize)
+	loadTrustedProxies()
+	maxPins = envInt("MAX_PINS", maxPins)
+	importBatchSize = envInt("IMPORT_BATCH_SIZE", importBatchSize)
+	fromURLTimeout = envDuration("FROM_URL_TIMEOUT", fromURLTimeout)
+	fromURLMaxBytes = int64(envInt("FROM_URL_MAX_BYTES", int(fromURLMaxBytes)))
+	maxTitleLength = envInt("MAX_TITLE_LENGTH", maxTitleLength)
+	maxBodyLength = envInt("MAX_BODY_LENGTH", maxBodyLength)
+	softBodyLength = envInt("SOFT_BODY_LENGTH", softBodyLength)
+	maxTags = envInt("MAX_TAGS", maxTags)
+	maxTagLength = envInt("MAX_TAG_LENGTH", maxTagLength)
+	if v, ok := os.LookupEnv("TITLE_COLLATION"); ok {
+		if v != "" && !collationRe.MatchString(v) {
+			log.Fatalf("invalid TITLE_COLLATION %q", v)
+		}
+		titleCollation = v
+	}
+	applyTitleCollation()
+	if v := os.Getenv("DEFAULT_SORT"); v != "" {
+		if _, ok := sortOrders[v]; !ok {
+			log.Fatalf("invalid DEFAULT_SORT %q", v)
+		}
+		defaultSort = v
+	}
+	if v := os.Getenv("NOTES_TABLE"); v != "" {
+		if !identifierRe.MatchString(v) {
+			log.Fatalf("invalid NOTES_TABLE %q: must be a plain SQL identifier", v)
+		}
+		notesTable = v
+	}
+	switch v := os.Getenv("NOTE_IDS"); v {
+	case "", "serial":
+	case "uuid":
+		uuidIDs = true
+	default:
+		log.Fatalf("invalid NOTE_IDS %q: want serial or uuid", v)
+	}
+	adminToken = os.Getenv("ADMIN_TOKEN")
+	if v := os.Getenv("BASE_URL"); v != "" {
+		u, err := parseBaseURL(v)
+		if err != nil {
+			log.Fatalf("invalid BASE_URL %q: %v", v, err)
+		}
+		publicBaseURL = u
+	}
+	allowedHosts = loadAllowedHosts(os.Getenv("ALLOWED_HOSTS"))
+	queryTimeout = envDuration("DB_QUERY_TIMEOUT", 10*time.Second)
+	maxChangesWait = envDuration("CHANGES_MAX_WAIT", maxChangesWait)
+	changesWindow = envDuration("CHANGES_WINDOW", changesWindow)
+	staticMaxAge = envDuration("STATIC_MAX_AGE", staticMaxAge)
+	debugLogging = os.Getenv("LOG_LEVEL") == "debug"
+	compressionEnabled = envBool("COMPRESSION", compressionEnabled)
+	csrfEnabled = envBool("CSRF_PROTECTION", csrfEnabled)
+	auditEnabled = envBool("AUDIT_LOG", auditEnabled)
+	maxDecompressedImport = int64(envInt("IMPORT_MAX_DECOMPRESSED", int(maxDecompressedImport)))
+	gzipLevel = envInt("GZIP_LEVEL", gzipLevel)
+	brotliLevel = envInt("BROTLI_LEVEL", brotliLevel)
+	zstdLevel = envInt("ZSTD_LEVEL", zstdLevel)
+	replaceInvalidUTF8 = os.Getenv("INVALID_UTF8") == "replace"
+	normalizeNFC = envBool("NORMALIZE_NFC", normalizeNFC)
+	stripControlChars = envBool("STRIP_CONTROL_CHARS", stripControlChars)
+	readOnly.Store(envBool("READ_ONLY", false))
+	binaryBodyRatio = envFloat("BINARY_BODY_RATIO", binaryBodyRatio)
+	if v := os.Getenv("DEFAULT_LANGUAGE"); v != "" {
+		defaultLanguage = strings.ToLower(v)
+	}
+	detectLanguage = envBool("LANGUAGE_DETECT", detectLanguage)
+	titleFromHeading = envBool("TITLE_FROM_HEADING", titleFromHeading)
+	lowercaseTags = envBool("LOWERCASE_TAGS", lowercaseTags)
+	analyzeAfterBulk = envBool("ANALYZE_AFTER_BULK", analyzeAfterBulk)
+	analyzeMinRows = envInt("ANALYZE_MIN_ROWS", analyzeMinRows)
+	if v := os.Getenv("TRASH_RETENTION"); v != "" {
+		d, err := parseAge(v)
+		if err != nil {
+			log.Fatalf("invalid TRASH_RETENTION: %v", err)
+		}
+		trashRetention = d
+	}
+	if envBool("LIST_CACHE", true) {
+		listCache = newResponseCache(envDuration("LIST_CACHE_TTL", 5*time.Second), envInt("LIST_CACHE_MAX_ENTRIES", 1000))
+	}
+	if envBool("SEARCH_CACHE", true) {
+		searchCache = newResponseCache(envDuration("SEARCH_CACHE_TTL", 30*time.Second), envInt("SEARCH_CACHE_MAX_ENTRIES", 1000))
+	}
+	maxSubscribers = envInt("SSE_MAX_SUBSCRIBERS", maxSubscribers)
+	maxConcurrentPerIP = envInt("MAX_CONCURRENT_PER_IP", maxConcurrentPerIP)
+	heavyOps.configure(envInt("MAX_HEAVY_OPS", 2), envDuration("HEAVY_OP_WAIT", 10*time.Second))
+	jobs.configure(envInt("JOB_WORKERS", 2), envInt("JOB_QUEUE_SIZE", 100))
+	shutdownTimeout = envDuration("SHUTDOWN_TIMEOUT", shutdownTimeout)
+	searchLimit.configure(envInt("SEARCH_RATE_LIMIT", 60), envInt("SEARCH_RATE_BURST", 10))
+}
+
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return n
+}
+
+func envFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return f
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return d
+}
+
+func envBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return b
+}
+
+// validateDSN checks DATABASE_URL before connecting, since sql.Open accepts
+// anything and a typo would otherwise surface as a vague dial error.
+// Errors never include the DSN itself, which may hold a password.
+func validateDSN(dsn string) error {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return errors.New("malformed URL")
+		}
+		if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+			return fmt.Errorf("unsupported scheme %q (want postgres or postgresql)", u.Scheme)
+		}
+		if u.Hostname() == "" && u.Query().Get("host") == "" {
+			return errors.New("missing host")
+		}
+	}
+	if _, err := pq.NewConnector(dsn); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// noteEvent is one message on the /api/notes/events stream. Content
+// changes carry the whole note; state changes (pin, public, trash, order)
+// carry only the fields that changed.
+type noteEvent struct {
+	Type  string         `json:"type"`
+	ID    int64          `json:"id"`
+	State map[string]any `json:"state,omitempty"`
+	Note  *Note          `json:"note,omitempty"`
+}
+
+// eventHub fans events out to connected stream clients. A client that
+// falls behind loses events rather than stalling writers.
+type eventHub struct {
+	mu       sync.Mutex
+	subs     map[chan noteEvent]struct{}
+	rejected atomic.Int64
+}
+
+var events = &eventHub{subs: map[chan noteEvent]struct{}{}}
+
+// maxSubscribers caps concurrent event streams (SSE_MAX_SUBSCRIBERS); 0
+// means no cap.
+var maxSubscribers = 100
+
+// subscribe registers a stream client. ok is false when maxSubscribers
+// are already connected.
+func (h *eventHub) subscribe() (ch chan noteEvent, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if maxSubscribers > 0 && len(h.subs) >= maxSubscribers {
+		h.rejected.Add(1)
+		return nil, false
+	}
+	ch = make(chan noteEvent, 64)
+	h.subs[ch] = struct{}{}
+	return ch, true
+}
+
+func (h *eventHub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+func (h *eventHub) unsubscribe(ch chan noteEvent) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+}
+
+func (h *eventHub) publish(ev noteEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// publishNote announces a created or updated note.
+func publishNote(typ string, n Note) {
+	events.publish(noteEvent{Type: typ, ID: n.ID, Note: &n})
+}
+
+// publishState announces a state change of note id.
+func publishState(typ string, id int64, state map[string]any) {
+	events.publish(noteEvent{Type: typ, ID: id, State: state})
+}
+
+const eventHeartbeat = 30 * time.Second
+
+// handleEvents serves GET /api/notes/events as a Server-Sent Events stream.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apiError(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch, ok := events.subscribe()
+	if !ok {
+		w.Header().Set("Retry-After", "30")
+		apiError(w, "too many event stream clients", http.StatusServiceUnavailable)
+		return
+	}
+	defer events.unsubscribe(ch)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+	tick := time.NewTicker(eventHeartbeat)
+	defer tick.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-tick.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case ev := <-ch:
+			b, merr := json.Marshal(ev)
+			if merr != nil {
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, b)
+		}
+		if err != nil {
+			// The client is gone; the heartbeat makes sure this is
+			// noticed even when no events flow.
+			return
+		}
+		flusher.Flush()
+	}
+}
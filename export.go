@@ -0,0 +1,302 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+type manifestNote struct {
+	ID          int64     `json:"id"`
+	UUID        string    `json:"uuid"`
+	Title       string    `json:"title"`
+	File        string    `json:"file"`
+	Tags        []string  `json:"tags"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Attachments []string  `json:"attachments,omitempty"`
+
+	dir string
+}
+
+// exportFormat is a way of writing one note to a file.
+type exportFormat struct {
+	ext         string
+	contentType string
+	render      func(Note) ([]byte, error)
+}
+
+// exportFormats are the values of the format parameter and of a note's
+// export_format, which exports use when no format is asked for.
+var exportFormats = map[string]*exportFormat{
+	"md": {".md", "text/markdown; charset=utf-8", func(n Note) ([]byte, error) {
+		return []byte(noteMarkdown(n)), nil
+	}},
+	"txt": {".txt", "text/plain; charset=utf-8", func(n Note) ([]byte, error) {
+		return []byte(n.Title + "\n\n" + n.Body + "\n"), nil
+	}},
+	"json": {".json", "application/json", func(n Note) ([]byte, error) {
+		return json.MarshalIndent(n, "", "  ")
+	}},
+}
+
+func exportFormatNames() string {
+	names := make([]string, 0, len(exportFormats))
+	for f := range exportFormats {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// formatFor picks the format for exporting n: the one requested, else the
+// note's export_format, else Markdown.
+func formatFor(requested string, n Note) *exportFormat {
+	if f := exportFormats[requested]; f != nil {
+		return f
+	}
+	if n.ExportFormat != nil && exportFormats[*n.ExportFormat] != nil {
+		return exportFormats[*n.ExportFormat]
+	}
+	return exportFormats["md"]
+}
+
+// requestedFormat returns the format parameter, checked.
+func requestedFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	f := r.URL.Query().Get("format")
+	if f != "" && exportFormats[f] == nil {
+		apiError(w, "format must be one of "+exportFormatNames(), http.StatusBadRequest)
+		return "", false
+	}
+	return f, true
+}
+
+// exportNote serves GET /api/notes/{id}/export[?format=md|txt|json] as a
+// file download.
+func exportNote(w http.ResponseWriter, r *http.Request, id int64) {
+	format, ok := requestedFormat(w, r)
+	if !ok {
+		return
+	}
+	defer observeQuery("export", time.Now())
+	var n Note
+	err := retry(func() error {
+		var err error
+		n, err = scanNote(db.QueryRow("SELECT "+noteColumns+" FROM "+notesTable+" WHERE id = $1 AND deleted_at IS NULL", id))
+		return err
+	})
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	f := formatFor(format, n)
+	body, err := f.render(n)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+noteRef(n)+"-"+slugify(n.Title)+f.ext+`"`)
+	w.Write(body)
+}
+
+// exportFilters is listFilters for exports, which include scheduled and
+// snoozed notes unless include_scheduled or include_snoozed says otherwise:
+// an export without filters is a full backup.
+func exportFilters(r *http.Request) (*whereClause, error) {
+	qs := r.URL.Query()
+	for _, p := range []string{"include_scheduled", "include_snoozed"} {
+		if !qs.Has(p) {
+			qs.Set(p, "true")
+		}
+	}
+	er := r.Clone(r.Context())
+	er.URL.RawQuery = qs.Encode()
+	return listFilters(er)
+}
+
+// handleExportZip streams the notes matching the list filters (tag,
+// notebook, created_after, q, ...; all notes without any) as files in a ZIP
+// archive, with attachments in a folder named like the note and a
+// manifest.json. Each note is written in format, or else in its own
+// export_format. The archive is written through a pipe, so nothing is
+// buffered whole.
+func handleExportZip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	where, err := exportFilters(r)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, ok := requestedFormat(w, r)
+	if !ok {
+		return
+	}
+	defer observeQuery("export", time.Now())
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeExport(r.Context(), pw, where, format))
+	}()
+	defer pr.Close()
+	name := "notes-" + clock.Now().UTC().Format("20060102") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	if _, err := io.Copy(w, pr); err != nil {
+		// Headers are gone by now; all that is left is to cut the
+		// archive short and say why.
+		log.Printf("error: export: %v req=%s", err, requestID(r))
+	}
+}
+
+func writeExport(ctx context.Context, out io.Writer, where *whereClause, format string) error {
+	zw := zip.NewWriter(out)
+	manifest := []*manifestNote{}
+	byID := map[int64]*manifestNote{}
+	var ids []int64
+	rows, err := db.QueryContext(ctx, "SELECT "+noteColumns+" FROM "+notesTable+where.String()+" ORDER BY id", where.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return err
+		}
+		ef := formatFor(format, n)
+		content, err := ef.render(n)
+		if err != nil {
+			return err
+		}
+		dir := noteRef(n) + "-" + slugify(n.Title)
+		m := &manifestNote{
+			ID: n.ID, UUID: n.UUID, Title: n.Title, Tags: n.Tags,
+			File:      dir + ef.ext,
+			CreatedAt: n.CreatedAt, UpdatedAt: n.UpdatedAt, dir: dir,
+		}
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: m.File, Method: zip.Deflate, Modified: n.UpdatedAt})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(content); err != nil {
+			return err
+		}
+		manifest = append(manifest, m)
+		byID[n.ID] = m
+		ids = append(ids, n.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	arows, err := db.QueryContext(ctx, `
+		SELECT id, note_id, filename, created_at, data FROM attachments
+		WHERE note_id = ANY($1) ORDER BY note_id, id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer arows.Close()
+	for arows.Next() {
+		var (
+			id, noteID int64
+			filename   string
+			created    time.Time
+			data       []byte
+		)
+		if err := arows.Scan(&id, &noteID, &filename, &created, &data); err != nil {
+			return err
+		}
+		m := byID[noteID]
+		name := m.dir + "/" + fmt.Sprintf("%d-%s", id, path.Base("/"+filename))
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: created})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+		m.Attachments = append(m.Attachments, name)
+	}
+	if err := arows.Err(); err != nil {
+		return err
+	}
+
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(map[string]any{"exported_at": clock.Now(), "notes": manifest}); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// noteMarkdown renders a note as a Markdown document: the title as a
+// heading, then its dates and tags, then the body.
+func noteMarkdown(n Note) string {
+	var b strings.Builder
+	title := n.Title
+	if title == "" {
+		title = "Untitled"
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "Created: %s\n", n.CreatedAt.UTC().Format(time.RFC3339))
+	if len(n.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s\n", strings.Join(n.Tags, ", "))
+	}
+	b.WriteString("\n")
+	b.WriteString(n.Body)
+	if !strings.HasSuffix(n.Body, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// slugify turns a title into a file name fragment: lowercase letters and
+// digits joined by hyphens, at most 50 runes.
+func slugify(title string) string {
+	var b strings.Builder
+	n, dash := 0, false
+	for _, r := range strings.ToLower(title) {
+		if n >= 50 {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+				n++
+			}
+			b.WriteRune(r)
+			n++
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "untitled"
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+)
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+}
+
+const feedExcerptLen = 300
+
+// handleFeed serves the n most recent notes (default 20, max 100) as RSS 2.0.
+func handleFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n := queryInt(r, "n", 20, 1, 100)
+	start := time.Now()
+	where := &whereClause{}
+	where.add("deleted_at IS NULL")
+	where.add(published(where))
+	limit := where.arg(n)
+	notes, err := queryNotes("SELECT "+noteColumns+" FROM "+notesTable+where.String()+
+		" ORDER BY created_at DESC LIMIT "+limit, where.args...)
+	observeQuery("list", start)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	base := baseURL(r)
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       indexData.AppName,
+			Link:        base + "/",
+			Description: "Recent notes",
+		},
+	}
+	for _, note := range notes {
+		link := base + "/api/notes/" + noteRef(note)
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       note.Title,
+			Link:        link,
+			Description: excerpt(note.Body, feedExcerptLen),
+			GUID:        link,
+			PubDate:     note.CreatedAt.Format(time.RFC1123Z),
+		})
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(feed)
+}
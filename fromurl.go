@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+var (
+	fromURLTimeout  = 10 * time.Second
+	fromURLMaxBytes = int64(2 << 20)
+)
+
+var errBlockedAddress = errors.New("destination address is not allowed")
+
+// blockedPrefixes are special-purpose ranges not covered by the netip
+// predicates used in publicAddr.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// publicAddr reports whether the server may connect to ip on a user's
+// behalf: loopback, private, link-local and other internal ranges are
+// refused.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchClient checks each address when the connection is made, after DNS
+// resolution, so neither redirects nor DNS rebinding can reach internal
+// hosts. Proxies from the environment are ignored for the same reason.
+var fetchClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				ap, err := netip.ParseAddrPort(address)
+				if err != nil || !publicAddr(ap.Addr()) {
+					return errBlockedAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return errors.New("redirect to unsupported scheme")
+		}
+		return nil
+	},
+}
+
+// handleFromURL serves POST /api/notes/from-url with {"url": "..."}. It
+// fetches the page, takes its <title> and readable text, and creates a note
+// with the address kept in metadata.source_url.
+func handleFromURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		apiError(w, "url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	title, body, err := fetchPage(r.Context(), u.String())
+	if err != nil {
+		apiError(w, "fetching url: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if strings.TrimSpace(title) == "" {
+		title = u.Host
+	}
+	n := Note{
+		Title:    truncateRunes(title, maxTitleLength),
+		Body:     truncateRunes(body, maxBodyLength),
+		Metadata: noteMetadata{"source_url": u.String()},
+	}
+	createNote(w, r, n)
+}
+
+func fetchPage(ctx context.Context, rawURL string) (title, body string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, fromURLTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9")
+	req.Header.Set("User-Agent", "simplenote/"+version)
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("status %s", resp.Status)
+	}
+	ct := resp.Header.Get("Content-Type")
+	rd, err := charset.NewReader(io.LimitReader(resp.Body, fromURLMaxBytes), ct)
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case strings.HasPrefix(ct, "text/plain"):
+		b, err := io.ReadAll(rd)
+		if err != nil {
+			return "", "", err
+		}
+		return "", strings.ToValidUTF8(string(b), "\uFFFD"), nil
+	case ct == "" || strings.HasPrefix(ct, "text/html") || strings.HasPrefix(ct, "application/xhtml+xml"):
+		title, body := extractText(rd)
+		return title, body, nil
+	default:
+		return "", "", fmt.Errorf("unsupported content type %q", ct)
+	}
+}
+
+// skippedElements hold no readable text.
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "head": true, "nav": true, "footer": true, "form": true,
+}
+
+// blockElements end a line of text.
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"article": true, "section": true, "blockquote": true, "pre": true,
+	"header": true, "main": true, "table": true, "ul": true, "ol": true,
+}
+
+// extractText returns a page's <title> and its visible text, one block per
+// line, with runs of whitespace collapsed.
+func extractText(rd io.Reader) (title, body string) {
+	z := html.NewTokenizer(rd)
+	var lines []string
+	var cur strings.Builder
+	skip := 0
+	inTitle := false
+	endLine := func() {
+		if s := strings.Join(strings.Fields(cur.String()), " "); s != "" {
+			lines = append(lines, s)
+		}
+		cur.Reset()
+	}
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			endLine()
+			return strings.Join(strings.Fields(title), " "), strings.Join(lines, "\n")
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if tag == "title" {
+				inTitle = tt == html.StartTagToken
+			}
+			if skippedElements[tag] && tt != html.SelfClosingTagToken {
+				if tt == html.StartTagToken {
+					skip++
+				} else if skip > 0 {
+					skip--
+				}
+			}
+			if blockElements[tag] {
+				endLine()
+			}
+		case html.TextToken:
+			text := string(z.Text())
+			if inTitle && title == "" {
+				title = text
+			} else if skip == 0 && utf8.ValidString(text) {
+				cur.WriteString(text)
+				cur.WriteByte(' ')
+			}
+		}
+	}
+}
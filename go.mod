@@ -2,4 +2,10 @@ module simplenote
 
 go 1.21
 
-require github.com/lib/pq v1.10.9
+require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/klauspost/compress v1.17.11
+	github.com/lib/pq v1.10.9
+	golang.org/x/net v0.35.0
+	golang.org/x/text v0.22.0
+)
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxDecompressedImport caps how much a gzipped import body may expand to
+// (IMPORT_MAX_DECOMPRESSED), so a small upload cannot inflate into an
+// unbounded stream.
+var maxDecompressedImport int64 = 1 << 30
+
+var errDecompressedTooLarge = errors.New("decompressed body too large")
+
+// capReader fails with errDecompressedTooLarge once more than n bytes are
+// read.
+type capReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *capReader) Read(p []byte) (int, error) {
+	if c.n < 0 {
+		return 0, fmt.Errorf("%w (max %d bytes)", errDecompressedTooLarge, maxDecompressedImport)
+	}
+	if int64(len(p)) > c.n+1 {
+		p = p[:c.n+1]
+	}
+	n, err := c.r.Read(p)
+	c.n -= int64(n)
+	if c.n < 0 {
+		return n, fmt.Errorf("%w (max %d bytes)", errDecompressedTooLarge, maxDecompressedImport)
+	}
+	return n, err
+}
+
+// decodeBody replaces r.Body with its decompressed form when it is sent
+// with Content-Encoding: gzip. It writes a 400 for a body that is not gzip
+// and a 415 for encodings it does not know, and then reports false.
+func decodeBody(w http.ResponseWriter, r *http.Request) bool {
+	switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+		return true
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			httpError(w, r, "malformed gzip body: "+err.Error(), http.StatusBadRequest)
+			return false
+		}
+		body := r.Body
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{&capReader{r: zr, n: maxDecompressedImport}, body}
+		r.Header.Del("Content-Encoding")
+		return true
+	default:
+		httpError(w, r, "unsupported Content-Encoding "+enc, http.StatusUnsupportedMediaType)
+		return false
+	}
+}
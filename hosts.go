@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// publicBaseURL, from BASE_URL, is the origin used for every absolute
+	// link the server generates, e.g. "https://notes.example.com".
+	publicBaseURL string
+	// allowedHosts, from ALLOWED_HOSTS, lists the Host values accepted;
+	// empty accepts any.
+	allowedHosts map[string]bool
+)
+
+func parseBaseURL(v string) (string, error) {
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("want an absolute http or https URL")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("must not have a query or fragment")
+	}
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+func loadAllowedHosts(v string) map[string]bool {
+	hosts := map[string]bool{}
+	for _, h := range strings.Split(v, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts[h] = true
+		}
+	}
+	return hosts
+}
+
+func hostAllowed(host string) bool {
+	if len(allowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	if allowedHosts[host] {
+		return true
+	}
+	h, _, err := net.SplitHostPort(host)
+	return err == nil && allowedHosts[h]
+}
+
+// checkHost rejects requests whose Host header is not in ALLOWED_HOSTS, so a
+// spoofed Host cannot end up in generated links or cached responses.
+func checkHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hostAllowed(r.Host) {
+			httpError(w, r, "unknown host", http.StatusMisdirectedRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// baseURL returns the origin for absolute links: BASE_URL when set,
+// otherwise one built from the request, whose Host checkHost has vetted.
+func baseURL(r *http.Request) string {
+	if publicBaseURL != "" {
+		return publicBaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// importBatchSize is how many notes each import transaction inserts
+// (IMPORT_BATCH_SIZE); a request may override it with ?batch_size=.
+var importBatchSize = 500
+
+// maxImportLine bounds a single NDJSON line so one runaway record cannot
+// exhaust memory.
+const maxImportLine = 64 << 20
+
+const maxImportErrors = 100
+
+var errLineTooLong = errors.New("line too long")
+
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type importProgress struct {
+	Imported int           `json:"imported"`
+	Existing int           `json:"skipped_existing"`
+	Failed   int           `json:"failed"`
+	Done     bool          `json:"done,omitempty"`
+	Errors   []importError `json:"errors,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// importItem is a note to import. A non-zero created replaces the server
+// clock's timestamps, with updated defaulting to it.
+type importItem struct {
+	line             int
+	note             Note
+	atts             []attachmentData
+	created, updated time.Time
+}
+
+// handleImportNDJSON serves POST /api/notes/import-ndjson. The body holds
+// one note object per line and is read incrementally, so memory use does
+// not grow with the file. Invalid lines are skipped and reported; valid
+// ones are inserted batch by batch, each batch in its own transaction. The
+// response is NDJSON too: a progress line after every committed batch and
+// a final line with "done": true. With keep_created_at=true (admin only),
+// each note's created_at and updated_at are kept.
+func handleImportNDJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !decodeBody(w, r) {
+		return
+	}
+	size := queryInt(r, "batch_size", importBatchSize, 1, 10000)
+	skipExisting := r.URL.Query().Get("skip_existing") == "true"
+	keepTimes, ok := keepTimestamps(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	var p importProgress
+	fail := func(line int, err error) {
+		p.Failed++
+		if len(p.Errors) < maxImportErrors {
+			p.Errors = append(p.Errors, importError{Line: line, Error: err.Error()})
+		}
+	}
+	batch := make([]importItem, 0, size)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := importBatch(requestActor(r), batch, &p, fail, skipExisting)
+		batch = batch[:0]
+		if err != nil {
+			return err
+		}
+		notesChanged()
+		enc.Encode(importProgress{Imported: p.Imported, Existing: p.Existing, Failed: p.Failed})
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	br := bufio.NewReader(r.Body)
+	for line := 1; ; line++ {
+		b, err := readLine(br, maxImportLine)
+		if err == errLineTooLong {
+			fail(line, err)
+			continue
+		}
+		if err != nil && err != io.EOF {
+			p.Error = "reading body: " + err.Error()
+			break
+		}
+		if b = bytes.TrimSpace(b); len(b) > 0 {
+			if it, perr := parseImportLine(b, line, keepTimes); perr != nil {
+				fail(line, perr)
+			} else if batch = append(batch, it); len(batch) == size {
+				if ferr := flush(); ferr != nil {
+					p.Error = ferr.Error()
+					break
+				}
+			}
+		}
+		if err == io.EOF {
+			if ferr := flush(); ferr != nil {
+				p.Error = ferr.Error()
+			}
+			break
+		}
+	}
+	p.Done = true
+	analyzeNotes("import", p.Imported)
+	enc.Encode(p)
+}
+
+// parseImportLine decodes and prepares the note on one NDJSON line.
+func parseImportLine(b []byte, line int, keepTimes bool) (importItem, error) {
+	it := importItem{line: line}
+	if !replaceInvalidUTF8 && !utf8.Valid(b) {
+		return it, errInvalidUTF8
+	}
+	err := json.Unmarshal(b, &it.note)
+	if err == nil && keepTimes && !it.note.CreatedAt.IsZero() {
+		it.created, it.updated, err = importTimes(it.note.CreatedAt, it.note.UpdatedAt)
+	}
+	if err != nil {
+		return it, err
+	}
+	it.atts, err = prepareNote(&it.note)
+	return it, err
+}
+
+// importBatch inserts items in one transaction. A note rejected by the pin
+// limit is counted as failed; any other error rolls back the whole batch.
+// With skipExisting, notes already stored are left out and counted in
+// p.Existing.
+func importBatch(a actor, items []importItem, p *importProgress, fail func(int, error), skipExisting bool) error {
+	defer observeQuery("create", time.Now())
+	imported, existing := 0, 0
+	var rejected []importItem
+	err := withTx(func(tx *sql.Tx) error {
+		imported, existing = 0, 0
+		var skip []bool
+		if skipExisting {
+			var err error
+			if skip, err = existingItems(tx, items); err != nil {
+				return err
+			}
+		}
+		var ids []int64
+		for i, it := range items {
+			if skip != nil && skip[i] {
+				existing++
+				continue
+			}
+			out, err := insertNote(tx, it.note, it.atts)
+			if errors.Is(err, errPinLimit) {
+				rejected = append(rejected, it)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("line %d: %w", it.line, err)
+			}
+			if !it.created.IsZero() {
+				if it.updated.IsZero() {
+					it.updated = it.created
+				}
+				_, err = tx.Exec("UPDATE "+notesTable+" SET created_at = $2, updated_at = $3 WHERE id = $1", out.ID, it.created, it.updated)
+				if err != nil {
+					return err
+				}
+			}
+			ids = append(ids, out.ID)
+			imported++
+		}
+		return a.audit(tx, "create", ids...)
+	})
+	if err != nil {
+		return err
+	}
+	p.Imported += imported
+	p.Existing += existing
+	for _, it := range rejected {
+		fail(it.line, errPinLimit)
+	}
+	return nil
+}
+
+// keepTimestamps reports whether the import request asks to keep each
+// note's created_at (keep_created_at=true). Backdating notes is reserved
+// for admin requests; for others it answers 403 and returns ok false.
+func keepTimestamps(w http.ResponseWriter, r *http.Request) (keep, ok bool) {
+	if r.URL.Query().Get("keep_created_at") != "true" {
+		return false, true
+	}
+	if !isAdmin(r) {
+		apiError(w, "keep_created_at requires the admin token", http.StatusForbidden)
+		return false, false
+	}
+	return true, true
+}
+
+// maxClockSkew is how far in the future a kept created_at may lie.
+const maxClockSkew = 5 * time.Minute
+
+var minCreatedAt = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// importTimes checks a kept created_at and updated_at. A missing updated_at,
+// or one before created_at, becomes created_at.
+func importTimes(created, updated time.Time) (time.Time, time.Time, error) {
+	if created.Before(minCreatedAt) || created.After(clock.Now().Add(maxClockSkew)) {
+		return created, updated, fmt.Errorf("created_at %s is out of range", created.Format(time.RFC3339))
+	}
+	if updated.Before(created) || updated.After(clock.Now().Add(maxClockSkew)) {
+		updated = created
+	}
+	return created, updated, nil
+}
+
+// readLine returns the next line without its newline. A line longer than
+// max is discarded up to its end and reported as errLineTooLong.
+func readLine(br *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if len(line)+len(chunk) > max {
+			line = nil
+			for err == bufio.ErrBufferFull {
+				_, err = br.ReadSlice('\n')
+			}
+			if err == nil || err == io.EOF {
+				return nil, errLineTooLong
+			}
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return bytes.TrimSuffix(line, []byte("\n")), err
+		}
+	}
+}
+
+// existingItems reports which items are already stored: a note with the
+// same title and body, or with the item's external_id. Later copies of an
+// item within items count as existing too. The lookup is one query per
+// batch.
+func existingItems(tx *sql.Tx, items []importItem) ([]bool, error) {
+	titles := make([]string, len(items))
+	bodies := make([]string, len(items))
+	extIDs := make([]sql.NullString, len(items))
+	for i, it := range items {
+		titles[i], bodies[i] = it.note.Title, it.note.Body
+		if it.note.ExternalID != nil {
+			extIDs[i] = sql.NullString{String: *it.note.ExternalID, Valid: true}
+		}
+	}
+	rows, err := tx.Query(`
+		SELECT t.i FROM unnest($1::text[], $2::text[], $3::text[]) WITH ORDINALITY AS t(title, body, ext, i)
+		WHERE EXISTS (SELECT 1 FROM `+notesTable+` n
+				WHERE n.title = t.title AND md5(n.body) = md5(t.body) AND n.body = t.body AND n.deleted_at IS NULL)
+			OR (t.ext IS NOT NULL AND EXISTS (SELECT 1 FROM `+notesTable+` n WHERE n.external_id = t.ext))
+	`, pq.Array(titles), pq.Array(bodies), pq.Array(extIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	skip := make([]bool, len(items))
+	for rows.Next() {
+		var i int
+		if err := rows.Scan(&i); err != nil {
+			return nil, err
+		}
+		skip[i-1] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	seen := map[[2]string]bool{}
+	for i, it := range items {
+		k := [2]string{it.note.Title, it.note.Body}
+		if seen[k] {
+			skip[i] = true
+		}
+		seen[k] = true
+	}
+	return skip, nil
+}
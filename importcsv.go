@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type csvImportResult struct {
+	Imported int           `json:"imported"`
+	Existing int           `json:"skipped_existing"`
+	Skipped  int           `json:"skipped"`
+	Errors   []importError `json:"errors,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// handleImportCSV serves POST /api/notes/import.csv. The header row names
+// the columns; title, body and tags are recognized case-insensitively, or
+// by the header given as map.title=, map.body= and map.tags=. Tags are
+// split on tag_separator (default ","). With keep_created_at=true (admin
+// only), a created_at column in RFC 3339 or YYYY-MM-DD dates the notes.
+// Rows are read one at a time and inserted in batches like the NDJSON
+// import; malformed or invalid rows are skipped and reported.
+func handleImportCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !decodeBody(w, r) {
+		return
+	}
+	qs := r.URL.Query()
+	sep := qs.Get("tag_separator")
+	if sep == "" {
+		sep = ","
+	}
+	keepTimes, ok := keepTimestamps(w, r)
+	if !ok {
+		return
+	}
+	cr := csv.NewReader(r.Body)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		apiError(w, "cannot read CSV header: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	header = append([]string(nil), header...)
+	cols := map[string]int{}
+	for _, field := range []string{"title", "body", "tags", "created_at"} {
+		name := field
+		if v := qs.Get("map." + field); v != "" {
+			name = v
+		}
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				cols[field] = i
+				break
+			}
+		}
+	}
+	if _, ok := cols["title"]; !ok {
+		if _, ok := cols["body"]; !ok {
+			apiError(w, "CSV header has neither a title nor a body column", http.StatusBadRequest)
+			return
+		}
+	}
+	size := queryInt(r, "batch_size", importBatchSize, 1, 10000)
+	skipExisting := qs.Get("skip_existing") == "true"
+	var p importProgress
+	var res csvImportResult
+	fail := func(line int, err error) {
+		res.Skipped++
+		if len(res.Errors) < maxImportErrors {
+			res.Errors = append(res.Errors, importError{Line: line, Error: err.Error()})
+		}
+	}
+	batch := make([]importItem, 0, size)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := importBatch(requestActor(r), batch, &p, fail, skipExisting)
+		batch = batch[:0]
+		if err == nil {
+			notesChanged()
+		}
+		return err
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			err = flush()
+			if err != nil {
+				res.Error = err.Error()
+			}
+			break
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			fail(perr.StartLine, perr.Err)
+			continue
+		}
+		if err != nil {
+			res.Error = "reading body: " + err.Error()
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if len(rec) != len(header) {
+			fail(line, fmt.Errorf("expected %d fields, got %d", len(header), len(rec)))
+			continue
+		}
+		var n Note
+		if i, ok := cols["title"]; ok {
+			n.Title = rec[i]
+		}
+		if i, ok := cols["body"]; ok {
+			n.Body = rec[i]
+		}
+		if i, ok := cols["tags"]; ok && strings.TrimSpace(rec[i]) != "" {
+			n.Tags = strings.Split(rec[i], sep)
+		}
+		it := importItem{line: line, note: n}
+		if i, ok := cols["created_at"]; ok && keepTimes && strings.TrimSpace(rec[i]) != "" {
+			t, err := parseDateParam(strings.TrimSpace(rec[i]))
+			if err == nil {
+				it.created, it.updated, err = importTimes(t, time.Time{})
+			}
+			if err != nil {
+				fail(line, fmt.Errorf("invalid created_at: %v", err))
+				continue
+			}
+		}
+		it.atts, err = prepareNote(&it.note)
+		if err != nil {
+			fail(line, err)
+			continue
+		}
+		batch = append(batch, it)
+		if len(batch) == size {
+			if err := flush(); err != nil {
+				res.Error = err.Error()
+				break
+			}
+		}
+	}
+	res.Imported = p.Imported
+	res.Existing = p.Existing
+	analyzeNotes("import", p.Imported)
+	status := http.StatusOK
+	if res.Error != "" {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, res)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// jobQueue runs background work on a fixed pool of workers so handlers do
+// not wait for it. The queue is bounded: enqueue refuses work when it is
+// full rather than block the caller. On shutdown, queued jobs are drained.
+type jobQueue struct {
+	mu      sync.RWMutex
+	queue   chan job
+	closed  bool
+	workers sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	running   atomic.Int64
+	completed atomic.Int64
+	failed    atomic.Int64
+	rejected  atomic.Int64
+}
+
+type job struct {
+	name string
+	run  func(context.Context) error
+}
+
+// jobs has JOB_WORKERS workers and room for JOB_QUEUE_SIZE waiting jobs.
+var jobs jobQueue
+
+func (q *jobQueue) configure(workers, size int) {
+	q.queue = make(chan job, max(size, 0))
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	for i := 0; i < max(workers, 1); i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+}
+
+func (q *jobQueue) work() {
+	defer q.workers.Done()
+	for j := range q.queue {
+		q.running.Add(1)
+		q.runJob(j)
+		q.running.Add(-1)
+	}
+}
+
+func (q *jobQueue) runJob(j job) {
+	start := time.Now()
+	defer func() {
+		if p := recover(); p != nil {
+			q.failed.Add(1)
+			log.Printf("error: job %s panicked: %v", j.name, p)
+		}
+	}()
+	if err := j.run(q.ctx); err != nil {
+		q.failed.Add(1)
+		log.Printf("error: job %s: %v (after %s)", j.name, err, time.Since(start).Round(time.Millisecond))
+		return
+	}
+	q.completed.Add(1)
+}
+
+// enqueue queues fn to run on a worker, named for logs. It reports false,
+// without running fn, when the queue is full or shutting down; callers
+// decide whether to drop the work, do it inline or tell the client to retry.
+func (q *jobQueue) enqueue(name string, fn func(context.Context) error) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed || q.queue == nil {
+		q.rejected.Add(1)
+		return false
+	}
+	select {
+	case q.queue <- job{name, fn}:
+		return true
+	default:
+		q.rejected.Add(1)
+		log.Printf("warning: job queue full, dropped %s", name)
+		return false
+	}
+}
+
+func (q *jobQueue) depth() int {
+	return len(q.queue)
+}
+
+// drain stops accepting jobs and waits up to timeout for the queued and
+// running ones to finish. Jobs still running then have their context
+// cancelled and are abandoned.
+func (q *jobQueue) drain(timeout time.Duration) {
+	q.mu.Lock()
+	if q.closed || q.queue == nil {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.queue)
+	q.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("warning: shutdown: %d jobs left unfinished", q.depth()+int(q.running.Load()))
+		q.cancel()
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var (
+	// defaultLanguage is the text search configuration given to notes that
+	// do not name one (DEFAULT_LANGUAGE).
+	defaultLanguage = "english"
+	// detectLanguage guesses the language of notes that do not name one
+	// instead of using defaultLanguage (LANGUAGE_DETECT). Clients can also
+	// ask for a guess with "language": "auto".
+	detectLanguage bool
+)
+
+// searchLanguages holds the text search configurations the database
+// offers, loaded by initSearch. Empty means unknown: nothing is rejected.
+var searchLanguages = map[string]bool{}
+
+// normalizeLanguage lowercases n.Language and fills it in when empty or
+// "auto".
+func normalizeLanguage(n *Note) {
+	n.Language = strings.ToLower(strings.TrimSpace(n.Language))
+	if n.Language == "auto" || (n.Language == "" && detectLanguage) {
+		n.Language = guessLanguage(n.Title + "\n" + n.Body)
+	}
+	if n.Language == "" {
+		n.Language = defaultLanguage
+	}
+}
+
+func validateLanguage(lang string) string {
+	if len(searchLanguages) == 0 || searchLanguages[lang] {
+		return ""
+	}
+	names := make([]string, 0, len(searchLanguages))
+	for l := range searchLanguages {
+		names = append(names, l)
+	}
+	sort.Strings(names)
+	return "unsupported; want one of " + strings.Join(names, ", ")
+}
+
+// stopwords are frequent words that tell languages apart well enough to
+// pick a stemmer.
+var stopwords = map[string][]string{
+	"english":    {"the", "and", "is", "of", "to", "in", "that", "it", "with", "for", "this", "was"},
+	"german":     {"der", "die", "das", "und", "ist", "nicht", "ich", "mit", "sich", "auch", "ein", "zu"},
+	"french":     {"le", "la", "les", "et", "est", "des", "une", "pas", "que", "pour", "dans", "qui"},
+	"spanish":    {"el", "los", "las", "y", "es", "del", "una", "que", "por", "para", "con", "pero"},
+	"italian":    {"il", "gli", "della", "e", "è", "che", "non", "una", "per", "sono", "con", "questo"},
+	"portuguese": {"o", "os", "as", "e", "não", "uma", "que", "do", "da", "para", "com", "é"},
+	"dutch":      {"de", "het", "een", "en", "is", "niet", "van", "ik", "dat", "met", "zijn", "voor"},
+	"russian":    {"и", "в", "не", "на", "что", "я", "с", "он", "как", "это", "по", "но"},
+}
+
+var stopwordLanguages = func() map[string][]string {
+	m := map[string][]string{}
+	for lang, words := range stopwords {
+		for _, w := range words {
+			m[w] = append(m[w], lang)
+		}
+	}
+	return m
+}()
+
+// guessLanguage returns the configuration whose stopwords are most common
+// in text, or "" when there are too few to tell.
+func guessLanguage(text string) string {
+	scores := map[string]int{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, w := range words {
+		for _, lang := range stopwordLanguages[w] {
+			scores[lang]++
+		}
+	}
+	best, bestScore, tie := "", 0, false
+	for lang, s := range scores {
+		if s > bestScore {
+			best, bestScore, tie = lang, s, false
+		} else if s == bestScore {
+			tie = true
+		}
+	}
+	if bestScore < 3 || tie || (len(searchLanguages) > 0 && !searchLanguages[best]) {
+		return ""
+	}
+	return best
+}
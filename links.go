@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var wikiLinkRe = regexp.MustCompile(`\[\[([^\[\]]+)\]\]`)
+
+// parseWikiLinks returns the distinct titles referenced as [[Title]] in body.
+func parseWikiLinks(body string) []string {
+	seen := map[string]bool{}
+	var titles []string
+	for _, m := range wikiLinkRe.FindAllStringSubmatch(body, -1) {
+		t := strings.TrimSpace(m[1])
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		titles = append(titles, t)
+	}
+	return titles
+}
+
+// saveLinks replaces the outgoing links of note id with the notes whose
+// titles are referenced in body, and its incoming links with the notes that
+// reference title. Links are stored resolved, so both directions are
+// redone on every save: that way a note created or renamed after the notes
+// linking to it still gets its backlinks, and loses the stale ones.
+// References to unknown titles are dropped.
+func saveLinks(tx *sql.Tx, id int64, title, body string) error {
+	if _, err := tx.Exec("DELETE FROM note_links WHERE source_id = $1 OR target_id = $1", id); err != nil {
+		return err
+	}
+	if titles := parseWikiLinks(body); len(titles) > 0 {
+		_, err := tx.Exec(`
+			INSERT INTO note_links (source_id, target_id)
+			SELECT $1, id FROM `+notesTable+` WHERE title = ANY($2) AND id <> $1 AND deleted_at IS NULL
+			ON CONFLICT DO NOTHING
+		`, id, pq.Array(titles))
+		if err != nil {
+			return err
+		}
+	}
+	return linkFrom(tx, id, strings.TrimSpace(title))
+}
+
+// linkFrom links to note id from every other note whose body references
+// title. The substring match only narrows the candidates; parseWikiLinks
+// decides.
+func linkFrom(tx *sql.Tx, id int64, title string) error {
+	if title == "" {
+		return nil
+	}
+	rows, err := tx.Query("SELECT id, body FROM "+notesTable+" WHERE id <> $1 AND strpos(body, $2) > 0 AND strpos(body, '[[') > 0", id, title)
+	if err != nil {
+		return err
+	}
+	var sources []int64
+	for rows.Next() {
+		var src int64
+		var body string
+		if err := rows.Scan(&src, &body); err != nil {
+			rows.Close()
+			return err
+		}
+		for _, t := range parseWikiLinks(body) {
+			if t == title {
+				sources = append(sources, src)
+				break
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(sources) == 0 {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO note_links (source_id, target_id)
+		SELECT src, $1 FROM unnest($2::bigint[]) AS src
+		ON CONFLICT DO NOTHING
+	`, id, pq.Array(sources))
+	return err
+}
+
+func listBacklinks(w http.ResponseWriter, r *http.Request, id int64) {
+	defer observeQuery("backlinks", time.Now())
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM "+notesTable+" WHERE id = $1 AND deleted_at IS NULL)", id).Scan(&exists); err != nil {
+		serverError(w, err)
+		return
+	}
+	if !exists {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	notes, err := queryNotes(`
+		SELECT `+noteColumns+` FROM `+notesTable+`
+		WHERE id IN (SELECT source_id FROM note_links WHERE target_id = $1) AND deleted_at IS NULL
+		ORDER BY created_at DESC
+	`, id)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeNotesJSON(w, r, http.StatusOK, notes)
+}
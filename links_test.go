@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseWikiLinks(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{"no links", nil},
+		{"see [[Plan]]", []string{"Plan"}},
+		{"[[ Plan ]] and [[Plan]] and [[Ideas]]", []string{"Plan", "Ideas"}},
+		{"empty [[ ]] and unclosed [[Plan", nil},
+	}
+	for _, tt := range tests {
+		if got := parseWikiLinks(tt.body); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseWikiLinks(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestLinksResolveAfterCreateAndRename(t *testing.T) {
+	testDB(t)
+	linked := func(source, target int64) bool {
+		t.Helper()
+		var ok bool
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM note_links WHERE source_id = $1 AND target_id = $2)", source, target).Scan(&ok)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	src := createTestNote(t, Note{Title: "source", Body: "see [[ Plan ]]"})
+	plan := createTestNote(t, Note{Title: "Plan", Body: "x"})
+	if !linked(src.ID, plan.ID) {
+		t.Error("link to a note created later not resolved")
+	}
+
+	path := "/api/notes/" + strconv.FormatInt(plan.ID, 10)
+	if rec := doJSON(t, handleNoteByID, http.MethodPut, path, map[string]any{"title": "Roadmap", "body": "x"}); rec.Code != http.StatusOK {
+		t.Fatalf("rename: status %d: %s", rec.Code, rec.Body)
+	}
+	if linked(src.ID, plan.ID) {
+		t.Error("stale link kept after the target was renamed")
+	}
+	if rec := doJSON(t, handleNoteByID, http.MethodPut, path, map[string]any{"title": "Plan", "body": "x"}); rec.Code != http.StatusOK {
+		t.Fatalf("rename back: status %d: %s", rec.Code, rec.Body)
+	}
+	if !linked(src.ID, plan.ID) {
+		t.Error("link not resolved after the target was renamed to match")
+	}
+}
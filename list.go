@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var sortOrders = map[string]string{
+	"created_desc": "created_at DESC, id DESC",
+	"created_asc":  "created_at ASC, id ASC",
+	"title_asc":    "title ASC, id ASC",
+	"title_desc":   "title DESC, id DESC",
+	"position":     "position ASC, id ASC",
+}
+
+// defaultSort applies when a request has no sort parameter.
+var defaultSort = "created_desc"
+
+// titleCollation is the collation used by the title sorts (TITLE_COLLATION).
+// The ICU root collation orders accents and case the way readers expect;
+// an empty value falls back to the database default.
+var titleCollation = "und-x-icu"
+
+var collationRe = regexp.MustCompile(`^[A-Za-z0-9_.@-]+$`)
+
+// applyTitleCollation rewrites the title sort orders for titleCollation.
+func applyTitleCollation() {
+	title := "title"
+	if titleCollation != "" {
+		title += ` COLLATE "` + titleCollation + `"`
+	}
+	sortOrders["title_asc"] = title + " ASC, id ASC"
+	sortOrders["title_desc"] = title + " DESC, id DESC"
+}
+
+// orderBy builds the ORDER BY clause for a list request. Pinned notes come
+// first, by pin_position, whatever the chosen sort, unless ignore_pins=true
+// is given. In a list of one notebook, notes pinned in that notebook come
+// before those.
+func orderBy(r *http.Request) (string, bool) {
+	key := r.URL.Query().Get("sort")
+	if key == "" {
+		key = defaultSort
+	}
+	order, ok := sortOrders[key]
+	if !ok {
+		return "", false
+	}
+	if r.URL.Query().Get("ignore_pins") != "true" {
+		order = "pinned DESC, pin_position ASC NULLS LAST, " + order
+		if nb := r.URL.Query().Get("notebook"); nb != "" && nb != "none" {
+			order = "notebook_pinned DESC, " + order
+		}
+	}
+	return order, true
+}
+
+// whereClause accumulates SQL conditions with numbered placeholders.
+type whereClause struct {
+	conds []string
+	args  []any
+}
+
+// arg registers v and returns its placeholder.
+func (c *whereClause) arg(v any) string {
+	c.args = append(c.args, v)
+	return "$" + strconv.Itoa(len(c.args))
+}
+
+func (c *whereClause) add(cond string) {
+	c.conds = append(c.conds, cond)
+}
+
+func (c *whereClause) String() string {
+	if len(c.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.conds, " AND ")
+}
+
+var errInvalidFields = errors.New("invalid search_fields: want title, body or both")
+
+const maxBatchIDs = 200
+
+// parseIDList parses the comma-separated ids parameter, integer ids or
+// UUIDs.
+func parseIDList(r *http.Request) ([]noteKey, error) {
+	v := r.URL.Query().Get("ids")
+	if v == "" {
+		return nil, nil
+	}
+	parts := strings.Split(v, ",")
+	if len(parts) > maxBatchIDs {
+		return nil, fmt.Errorf("too many ids (max %d)", maxBatchIDs)
+	}
+	keys := make([]noteKey, 0, len(parts))
+	for _, p := range parts {
+		k, err := parseNoteKey(p)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// listFilters translates list query parameters into SQL conditions.
+func listFilters(r *http.Request) (*whereClause, error) {
+	qs := r.URL.Query()
+	c := &whereClause{}
+	if qs.Get("trashed") == "true" {
+		c.add("deleted_at IS NOT NULL")
+	} else {
+		c.add("deleted_at IS NULL")
+	}
+	if qs.Get("include_scheduled") != "true" {
+		c.add(published(c))
+	}
+	if qs.Get("include_snoozed") != "true" && qs.Get("trashed") != "true" {
+		c.add(awake(c))
+	}
+	keys, err := parseIDList(r)
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		ids, uuids := splitNoteKeys(keys)
+		c.add("(id = ANY(" + c.arg(pq.Array(ids)) + "::bigint[]) OR uuid = ANY(" + c.arg(pq.Array(uuids)) + "::uuid[]))")
+	}
+	if tag := normalizeTag(qs.Get("tag")); tag != "" {
+		c.add(c.arg(tag) + " = ANY(tags)")
+	}
+	switch v := qs.Get("notebook"); v {
+	case "":
+	case "none":
+		c.add("notebook_id IS NULL")
+	default:
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notebook %q", v)
+		}
+		c.add("notebook_id = " + c.arg(id))
+	}
+	for _, f := range []struct{ param, op string }{{"created_after", " >= "}, {"created_before", " < "}} {
+		if v := qs.Get(f.param); v != "" {
+			t, err := parseDateParam(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: want RFC 3339 or YYYY-MM-DD", f.param)
+			}
+			c.add("created_at" + f.op + c.arg(t))
+		}
+	}
+	addMetaFilters(c, qs)
+	// language narrows the list to notes in that language and stems q the
+	// same way; otherwise q is stemmed as defaultLanguage.
+	config := defaultLanguage
+	if lang := strings.ToLower(qs.Get("language")); lang != "" {
+		if validateLanguage(lang) != "" {
+			return nil, fmt.Errorf("unsupported language %q", lang)
+		}
+		c.add("language = " + c.arg(lang))
+		config = lang
+	}
+	if q := strings.TrimSpace(qs.Get("q")); q != "" {
+		scope := searchScope(r)
+		var cond string
+		switch scope {
+		case "", "both":
+			if !fullTextSearch {
+				p := c.arg("%" + escapeLike(q) + "%")
+				cond = "(title ILIKE " + p + " OR body ILIKE " + p + ")"
+				break
+			}
+			cond = "search_vector @@ " + tsQuery(c, config, q, qs.Get("prefix") == "true")
+		case "title":
+			cond = "title ILIKE " + c.arg("%"+escapeLike(q)+"%")
+		case "body":
+			cond = "to_tsvector(language::regconfig, body) @@ " + tsQuery(c, config, q, qs.Get("prefix") == "true")
+		default:
+			return nil, errInvalidFields
+		}
+		if includeRevisions(r) {
+			cond = "(" + cond + " OR EXISTS (SELECT 1 FROM note_revisions rv WHERE rv.note_id = " + notesTable +
+				".id AND " + revisionCond(scope, c.arg(revisionQuery(scope, q))) + "))"
+		}
+		c.add(cond)
+	}
+	return c, nil
+}
+
+// parseDateParam accepts an RFC 3339 timestamp or a plain date, taken as
+// midnight UTC.
+func parseDateParam(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
+
+// published is the condition hiding notes scheduled with a future
+// publish_at.
+func published(c *whereClause) string {
+	return "(publish_at IS NULL OR publish_at <= " + c.arg(clock.Now()) + ")"
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// queryTimeout bounds list and search queries; 0 means no limit.
+var queryTimeout time.Duration
+
+func queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if queryTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), queryTimeout)
+}
+
+// listNotes serves GET /api/notes. select=id,title,... returns only the
+// named fields of each note, and search_fields (or fields) restricts q to
+// title, body or both. With allow_partial=true the response is wrapped as
+// {"notes": [...], "partial": bool}; partial is true when the query hit
+// DB_QUERY_TIMEOUT and notes holds only the rows read by then.
+func listNotes(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderBy(r)
+	if !ok {
+		apiError(w, "invalid sort", http.StatusBadRequest)
+		return
+	}
+	where, err := listFilters(r)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fields, err := projection(r)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pinnedFirst := r.URL.Query().Get("ignore_pins") != "true"
+	// A batch fetch by ids returns notes in the requested order unless
+	// a sort is given explicitly.
+	if keys, _ := parseIDList(r); keys != nil && r.URL.Query().Get("sort") == "" {
+		strs := make([]string, len(keys))
+		for i, key := range keys {
+			strs[i] = string(key)
+		}
+		k := where.arg(pq.Array(strs)) + "::text[]"
+		order = "COALESCE(array_position(" + k + ", id::text), array_position(" + k + ", uuid::text))"
+		pinnedFirst = false
+	}
+	w.Header().Set("X-Pinned-First", strconv.FormatBool(pinnedFirst))
+	key := r.URL.Query().Encode()
+	cache := listCache
+	if r.URL.Query().Get("q") != "" {
+		if !limitSearch(w, r) {
+			return
+		}
+		key, cache = searchKey(r), searchCache
+	}
+	// v1 and v2 responses to the same query differ.
+	key = strconv.Itoa(apiVersion(r)) + ":" + key
+	// Relative times and purge countdowns go stale, so those responses are
+	// never cached.
+	if r.URL.Query().Get("relative") == "true" || r.URL.Query().Get("trashed") == "true" {
+		cache = nil
+	}
+	var gen uint64
+	if cache != nil {
+		var body []byte
+		if body, gen, ok = cache.get(key); ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(body)
+			return
+		}
+	}
+	op := "list"
+	if r.URL.Query().Get("q") != "" {
+		op = "search"
+	}
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	start := time.Now()
+	query := "SELECT " + noteColumns + " FROM " + notesTable + where.String() + " ORDER BY " + order + pagination(r, where)
+	notes, err := queryNotesContext(ctx, query, where.args...)
+	observeQuery(op, start)
+	if ctx.Err() == context.DeadlineExceeded {
+		if r.URL.Query().Get("allow_partial") != "true" {
+			apiError(w, "query timed out", http.StatusGatewayTimeout)
+			return
+		}
+		// Results are incomplete: only rows received before the deadline.
+		w.Header().Set("Warning", `199 - "partial results: query timed out"`)
+		addRelative(r, notes)
+		addPurgeTimes(notes)
+		list, _ := renderNotes(r, notes, fields)
+		writeJSON(w, http.StatusOK, map[string]any{"notes": list, "partial": true})
+		return
+	}
+	if err == nil && includeRevisions(r) {
+		err = addRevisionMatches(notes, searchScope(r), strings.TrimSpace(r.URL.Query().Get("q")))
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	addRelative(r, notes)
+	addPurgeTimes(notes)
+	payload, err := renderNotes(r, notes, fields)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if r.URL.Query().Get("allow_partial") == "true" {
+		payload = map[string]any{"notes": payload, "partial": false}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	body = append(body, '\n')
+	if cache != nil {
+		cache.put(key, gen, body)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// handleCount returns how many notes the list endpoint would return for the
+// same filters, ignoring pagination.
+func handleCount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(r.URL.Query()) == 0 {
+		defer observeQuery("count", time.Now())
+		count, err := unfilteredCount()
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int64{"count": count})
+		return
+	}
+	where, err := listFilters(r)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start := time.Now()
+	var count int64
+	err = retry(func() error {
+		return db.QueryRow("SELECT COUNT(*) FROM "+notesTable+where.String(), where.args...).Scan(&count)
+	})
+	observeQuery("count", start)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{"count": count})
+}
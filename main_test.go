@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRestoreNote(t *testing.T) {
+	testDB(t)
+	n := createTestNote(t, Note{Title: "trashed", Body: "x"})
+	path := "/api/notes/" + strconv.FormatInt(n.ID, 10)
+	if rec := doJSON(t, handleNoteByID, http.MethodDelete, path, nil); rec.Code != http.StatusOK {
+		t.Fatalf("trash: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := db.Exec("UPDATE "+notesTable+" SET updated_at = $2 WHERE id = $1", n.ID, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if rec := doJSON(t, handleNoteByID, http.MethodPost, path+"/restore", nil); rec.Code != http.StatusOK {
+		t.Fatalf("restore: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := countNotes(t, "id = $1 AND deleted_at IS NULL AND updated_at > $2", n.ID, time.Now().Add(-time.Minute)); got != 1 {
+		t.Error("note not restored with a new updated_at")
+	}
+	if rec := doJSON(t, handleNoteByID, http.MethodPost, path+"/restore", nil); rec.Code != http.StatusConflict {
+		t.Errorf("restoring a live note: status %d, want 409", rec.Code)
+	}
+	if rec := doJSON(t, handleNoteByID, http.MethodPost, "/api/notes/999999/restore", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("restoring a missing note: status %d, want 404", rec.Code)
+	}
+}
+
+func TestServerErrorIsJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("X-Request-ID", "req-1")
+	serverError(rec, errors.New("boom"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", rec.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+	}
+	if body["error"] != "boom" || body["request_id"] != "req-1" {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	tests := []struct {
+		path, wantType string
+	}{
+		{"/api/notes", "application/json"},
+		{"/admin/stats", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		httpError(rec, httptest.NewRequest(http.MethodPost, tt.path, nil), "nope", http.StatusForbidden)
+		if got := rec.Header().Get("Content-Type"); got != tt.wantType || rec.Code != http.StatusForbidden {
+			t.Errorf("%s: %d %q, want 403 %q", tt.path, rec.Code, got, tt.wantType)
+		}
+	}
+}
+
+func TestQueryNotesContextKeepsPartialRows(t *testing.T) {
+	testDB(t)
+	// The first row is big enough that the server flushes it before it
+	// reaches the slow one.
+	first := createTestNote(t, Note{Title: "first", Body: strings.Repeat("x", 64<<10)})
+	createTestNote(t, Note{Title: "slow", Body: "x"})
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	notes, err := queryNotesContext(ctx,
+		"SELECT "+noteColumns+" FROM "+notesTable+" WHERE id = $1 OR pg_sleep(5) IS NOT NULL", first.ID)
+	if err == nil {
+		t.Fatal("query finished before the deadline")
+	}
+	if len(notes) != 1 || notes[0].ID != first.ID {
+		t.Errorf("got %d notes, want the one read before the deadline", len(notes))
+	}
+}
+
+func TestRestoreNoteChecks(t *testing.T) {
+	testDB(t)
+	saved := maxPins
+	defer func() { maxPins = saved }()
+	maxPins = 1
+
+	trash := func(id int64) {
+		t.Helper()
+		if _, err := db.Exec("UPDATE "+notesTable+" SET deleted_at = NOW() WHERE id = $1", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	restore := func(id int64) int {
+		return doJSON(t, handleNoteByID, http.MethodPost, "/api/notes/"+strconv.FormatInt(id, 10)+"/restore", nil).Code
+	}
+
+	pinned := createTestNote(t, Note{Title: "pinned", Body: "x", Pinned: true})
+	trash(pinned.ID)
+	createTestNote(t, Note{Title: "other pin", Body: "x", Pinned: true})
+	if code := restore(pinned.ID); code != http.StatusConflict {
+		t.Errorf("restoring a pin past the limit: status %d, want 409", code)
+	}
+	if n := countNotes(t, "id = $1 AND deleted_at IS NOT NULL", pinned.ID); n != 1 {
+		t.Error("note restored past the pin limit")
+	}
+
+	nb := createTestNotebook(t, "gone")
+	inNotebook := createTestNote(t, Note{Title: "in notebook", Body: "x", NotebookID: &nb.ID})
+	trash(inNotebook.ID)
+	if _, err := db.Exec("UPDATE notebooks SET deleted_at = NOW() WHERE id = $1", nb.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := restore(inNotebook.ID); code != http.StatusOK {
+		t.Fatalf("restore: status %d", code)
+	}
+	if n := countNotes(t, "id = $1 AND deleted_at IS NULL AND notebook_id IS NULL", inNotebook.ID); n != 1 {
+		t.Error("note restored into a trashed notebook")
+	}
+}
+
+func TestSaveNoteBodyLimit(t *testing.T) {
+	saved := maxBodySize
+	defer func() { maxBodySize = saved }()
+	maxBodySize = 64
+	for _, ct := range []string{"application/json", "application/x-www-form-urlencoded"} {
+		body := `{"title": "t", "body": "` + strings.Repeat("x", 100) + `"}`
+		if ct != "application/json" {
+			body = "title=t&body=" + strings.Repeat("x", 100)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/notes", strings.NewReader(body))
+		req.Header.Set("Content-Type", ct)
+		rec := httptest.NewRecorder()
+		handleNotes(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status %d, want 413", ct, rec.Code)
+		}
+	}
+}
+
+func TestIndexFeatureClasses(t *testing.T) {
+	tplBytes, err := staticFS.ReadFile("static/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedTpl, savedData := indexTpl, indexData
+	defer func() { indexTpl, indexData = savedTpl, savedData }()
+	indexTpl = template.Must(template.New("").Parse(string(tplBytes)))
+	indexData = pageData{AppName: "Notes", Features: map[string]bool{"beta_ui": true, "dark": true}}
+
+	rec := httptest.NewRecorder()
+	handleIndex(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `<body class="feature-beta_ui feature-dark ">`) {
+		t.Errorf("index body does not carry the feature classes:\n%s", body)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// renderMarkdown renders the common subset of Markdown: ATX headings,
+// paragraphs, fenced code, block quotes, lists, rules, and inline code,
+// emphasis and links. Raw HTML is escaped, not passed through.
+func renderMarkdown(body string) string {
+	var b strings.Builder
+	mdBlocks(&b, strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n"))
+	return b.String()
+}
+
+var (
+	mdHeading = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	mdRule    = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	mdBullet  = regexp.MustCompile(`^ {0,3}[-*+][ \t]+`)
+	mdOrdered = regexp.MustCompile(`^ {0,3}\d{1,9}[.)][ \t]+`)
+	mdFence   = regexp.MustCompile("^ {0,3}(```+|~~~+)[ \t]*([^` \t]*)")
+)
+
+func mdBlocks(b *strings.Builder, lines []string) {
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>" + mdInline(strings.Join(para, "\n")) + "</p>\n")
+			para = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case mdFence.MatchString(line):
+			flush()
+			m := mdFence.FindStringSubmatch(line)
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code")
+			if m[2] != "" {
+				b.WriteString(` class="language-` + html.EscapeString(m[2]) + `"`)
+			}
+			b.WriteString(">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case mdHeading.MatchString(line):
+			flush()
+			m := mdHeading.FindStringSubmatch(line)
+			tag := "h" + string(rune('0'+len(m[1])))
+			b.WriteString("<" + tag + ">" + mdInline(m[2]) + "</" + tag + ">\n")
+		case mdRule.MatchString(line):
+			flush()
+			b.WriteString("<hr>\n")
+		case strings.HasPrefix(strings.TrimLeft(line, " "), ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimLeft(lines[i], " "), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimLeft(lines[i], " "), ">")
+				quote = append(quote, strings.TrimPrefix(q, " "))
+			}
+			i--
+			b.WriteString("<blockquote>\n")
+			mdBlocks(b, quote)
+			b.WriteString("</blockquote>\n")
+		case mdBullet.MatchString(line), mdOrdered.MatchString(line):
+			flush()
+			marker, tag := mdBullet, "ul"
+			if !mdBullet.MatchString(line) {
+				marker, tag = mdOrdered, "ol"
+			}
+			b.WriteString("<" + tag + ">\n")
+			for i < len(lines) && marker.MatchString(lines[i]) {
+				item := []string{marker.ReplaceAllString(lines[i], "")}
+				// Indented lines continue the item.
+				for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "" &&
+					(lines[i][0] == ' ' || lines[i][0] == '\t') && !marker.MatchString(lines[i]); i++ {
+					item = append(item, strings.TrimSpace(lines[i]))
+				}
+				b.WriteString("<li>" + mdInline(strings.Join(item, "\n")) + "</li>\n")
+			}
+			i--
+			b.WriteString("</" + tag + ">\n")
+		default:
+			para = append(para, strings.TrimSpace(line))
+		}
+	}
+	flush()
+}
+
+var (
+	mdLink   = regexp.MustCompile(`\[([^\]]*)\]\(([^)\s]*)\)`)
+	mdStrong = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	mdEm     = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:.*?\S)?)[*_]($|[^\w*])`)
+)
+
+// mdInline renders the inline syntax of text. Code spans are taken out
+// first so nothing inside them is interpreted.
+func mdInline(text string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(text, '`')
+		j := -1
+		if i >= 0 {
+			j = strings.IndexByte(text[i+1:], '`')
+		}
+		if j < 0 {
+			b.WriteString(mdSpans(text))
+			break
+		}
+		b.WriteString(mdSpans(text[:i]))
+		b.WriteString("<code>" + html.EscapeString(text[i+1:i+1+j]) + "</code>")
+		text = text[i+2+j:]
+	}
+	return strings.ReplaceAll(b.String(), "\n", "<br>\n")
+}
+
+func mdSpans(s string) string {
+	s = html.EscapeString(s)
+	s = mdLink.ReplaceAllStringFunc(s, func(m string) string {
+		sub := mdLink.FindStringSubmatch(m)
+		if !safeURL(html.UnescapeString(sub[2]), false) {
+			return sub[1]
+		}
+		return `<a href="` + sub[2] + `" rel="nofollow noopener noreferrer">` + sub[1] + "</a>"
+	})
+	s = mdStrong.ReplaceAllStringFunc(s, func(m string) string {
+		sub := mdStrong.FindStringSubmatch(m)
+		if sub[1] != sub[3] {
+			return m
+		}
+		return "<strong>" + sub[2] + "</strong>"
+	})
+	return mdEm.ReplaceAllString(s, "$1<em>$2</em>$3")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+// handleMerge serves POST /api/notes/merge with {"primary": id,
+// "secondary": id, "separator": "\n\n", "trash_secondary": bool}: the
+// secondary's body is appended to the primary's after separator and the
+// tags are unioned, in one transaction. Notes with content_json are
+// refused. With trash_secondary the secondary
+// goes to the trash and its attachments move to the primary. The response
+// is the merged note.
+func handleMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Primary        noteKey `json:"primary"`
+		Secondary      noteKey `json:"secondary"`
+		Separator      *string `json:"separator"`
+		TrashSecondary bool    `json:"trash_secondary"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Primary == "" || req.Secondary == "" {
+		apiError(w, `body must be {"primary": id, "secondary": id}`, http.StatusBadRequest)
+		return
+	}
+	keys := []noteKey{req.Primary, req.Secondary}
+	ids, err := resolveNoteKeys(keys)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	primaryID, secondaryID := ids[0], ids[1]
+	if req.Primary == req.Secondary || primaryID != 0 && primaryID == secondaryID {
+		apiError(w, "primary and secondary must be different notes", http.StatusBadRequest)
+		return
+	}
+	sep := "\n\n"
+	if req.Separator != nil {
+		sep = *req.Separator
+	}
+	tx, err := beginTx()
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	defer tx.Rollback()
+	// Locked in id order so that concurrent merges cannot deadlock.
+	rows, err := tx.Query("SELECT "+noteColumns+" FROM "+notesTable+
+		" WHERE id = ANY($1) AND deleted_at IS NULL ORDER BY id FOR UPDATE",
+		pq.Array(ids))
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	found := map[int64]Note{}
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			rows.Close()
+			serverError(w, err)
+			return
+		}
+		found[n.ID] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		serverError(w, err)
+		return
+	}
+	var missing []noteKey
+	for i, id := range ids {
+		if _, ok := found[id]; !ok {
+			missing = append(missing, keys[i])
+		}
+	}
+	if len(missing) > 0 {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": errUnknownNotes.Error(), "missing": missing})
+		return
+	}
+	primary, secondary := found[primaryID], found[secondaryID]
+	// Their bodies are derived from content_json, so appending would be
+	// undone on save.
+	if len(primary.ContentJSON) > 0 || len(secondary.ContentJSON) > 0 {
+		apiError(w, "notes with content_json cannot be merged", http.StatusConflict)
+		return
+	}
+	primary.Body += sep + secondary.Body
+	primary.Tags = uniqueTags(append(primary.Tags, secondary.Tags...))
+	if req.TrashSecondary {
+		now := clock.Now()
+		_, err := tx.Exec("UPDATE "+notesTable+" SET deleted_at = $2, updated_at = $2 WHERE id = $1", secondary.ID, now)
+		if err == nil {
+			_, err = tx.Exec("UPDATE attachments SET note_id = $2 WHERE note_id = $1", secondary.ID, primary.ID)
+		}
+		if err == nil {
+			err = requestActor(r).audit(tx, "trash", secondary.ID)
+		}
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		secondary.DeletedAt = &now
+	}
+	// storeUpdate validates the result, commits and responds.
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	storeUpdate(rec, r, tx, primary.ID, primary)
+	if rec.status == http.StatusOK && req.TrashSecondary {
+		publishState("trashed", secondary.ID, map[string]any{"deleted_at": secondary.DeletedAt})
+	}
+}
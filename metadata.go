@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// noteMetadata holds user-defined key-value fields stored in the metadata
+// JSONB column. Numbers are kept as json.Number so integers survive a
+// round trip unchanged.
+type noteMetadata map[string]any
+
+func (m *noteMetadata) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(bytes.TrimSpace(b), []byte("null")) {
+		*m = nil
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v map[string]any
+	if err := dec.Decode(&v); err != nil {
+		return errors.New("metadata must be an object")
+	}
+	*m = v
+	return nil
+}
+
+func (m *noteMetadata) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("metadata: unexpected %T", src)
+	}
+	return m.UnmarshalJSON(b)
+}
+
+func (m noteMetadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]any(m))
+	return string(b), err
+}
+
+// validateMetadata checks that metadata is flat: every value must be a
+// string, number or boolean.
+func validateMetadata(m noteMetadata) string {
+	for k, v := range m {
+		if strings.TrimSpace(k) == "" {
+			return "keys must not be empty"
+		}
+		switch v.(type) {
+		case string, json.Number, bool:
+		default:
+			return fmt.Sprintf("value of %q must be a string, number or boolean", k)
+		}
+	}
+	return ""
+}
+
+// mergeMetadata applies a merge patch to metadata: listed keys are set,
+// keys set to null are removed and the rest are kept.
+func mergeMetadata(cur noteMetadata, raw json.RawMessage) (noteMetadata, error) {
+	var patch noteMetadata
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return cur, err
+	}
+	if patch == nil {
+		return noteMetadata{}, nil
+	}
+	out := noteMetadata{}
+	for k, v := range cur {
+		out[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(out, k)
+		} else {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+// addMetaFilters turns meta.<key>=<value> parameters into JSONB containment
+// conditions. Query values are strings, so a value that also reads as a
+// number or boolean matches either form.
+func addMetaFilters(c *whereClause, qs url.Values) {
+	keys := make([]string, 0)
+	for k := range qs {
+		if strings.HasPrefix(k, "meta.") && len(k) > len("meta.") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key := strings.TrimPrefix(k, "meta.")
+		for _, v := range qs[k] {
+			alts := []any{v}
+			if v == "true" || v == "false" {
+				alts = append(alts, v == "true")
+			} else if _, err := strconv.ParseFloat(v, 64); err == nil && json.Valid([]byte(v)) {
+				alts = append(alts, json.Number(v))
+			}
+			conds := make([]string, len(alts))
+			for i, a := range alts {
+				b, _ := json.Marshal(map[string]any{key: a})
+				conds[i] = "metadata @> " + c.arg(string(b)) + "::jsonb"
+			}
+			c.add("(" + strings.Join(conds, " OR ") + ")")
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type queryStat struct {
+	count int64
+	sum   time.Duration
+	max   time.Duration
+}
+
+var (
+	queryMu    sync.Mutex
+	queryStats = map[string]*queryStat{}
+
+	slowQueryThreshold time.Duration
+)
+
+// observeQuery records the duration of a database operation started at start.
+// Use as: defer observeQuery("list", time.Now()).
+func observeQuery(op string, start time.Time) {
+	d := time.Since(start)
+	queryMu.Lock()
+	st := queryStats[op]
+	if st == nil {
+		st = &queryStat{}
+		queryStats[op] = st
+	}
+	st.count++
+	st.sum += d
+	if d > st.max {
+		st.max = d
+	}
+	queryMu.Unlock()
+	if slowQueryThreshold > 0 && d >= slowQueryThreshold {
+		log.Printf("slow query: op=%s duration=%s", op, d)
+	}
+}
+
+func resetMetrics() {
+	queryMu.Lock()
+	queryStats = map[string]*queryStat{}
+	queryMu.Unlock()
+	if listCache != nil {
+		listCache.hits.Store(0)
+		listCache.misses.Store(0)
+	}
+	if searchCache != nil {
+		searchCache.hits.Store(0)
+		searchCache.misses.Store(0)
+	}
+	searchLimit.limited.Store(0)
+	concurrencyRejected.Store(0)
+	heavyOps.rejected.Store(0)
+	events.rejected.Store(0)
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	queryMu.Lock()
+	defer queryMu.Unlock()
+	ops := make([]string, 0, len(queryStats))
+	for op := range queryStats {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	fmt.Fprintln(w, "# TYPE simplenote_db_query_duration_seconds summary")
+	for _, op := range ops {
+		st := queryStats[op]
+		fmt.Fprintf(w, "simplenote_db_query_duration_seconds_sum{op=%q} %g\n", op, st.sum.Seconds())
+		fmt.Fprintf(w, "simplenote_db_query_duration_seconds_count{op=%q} %d\n", op, st.count)
+	}
+	fmt.Fprintln(w, "# TYPE simplenote_db_query_duration_seconds_max gauge")
+	for _, op := range ops {
+		fmt.Fprintf(w, "simplenote_db_query_duration_seconds_max{op=%q} %g\n", op, queryStats[op].max.Seconds())
+	}
+	if listCache != nil {
+		fmt.Fprintln(w, "# TYPE simplenote_list_cache_hits_total counter")
+		fmt.Fprintf(w, "simplenote_list_cache_hits_total %d\n", listCache.hits.Load())
+		fmt.Fprintln(w, "# TYPE simplenote_list_cache_misses_total counter")
+		fmt.Fprintf(w, "simplenote_list_cache_misses_total %d\n", listCache.misses.Load())
+	}
+	if searchCache != nil {
+		fmt.Fprintln(w, "# TYPE simplenote_search_cache_hits_total counter")
+		fmt.Fprintf(w, "simplenote_search_cache_hits_total %d\n", searchCache.hits.Load())
+		fmt.Fprintln(w, "# TYPE simplenote_search_cache_misses_total counter")
+		fmt.Fprintf(w, "simplenote_search_cache_misses_total %d\n", searchCache.misses.Load())
+	}
+	fmt.Fprintln(w, "# TYPE simplenote_search_rate_limited_total counter")
+	fmt.Fprintf(w, "simplenote_search_rate_limited_total %d\n", searchLimit.limited.Load())
+	fmt.Fprintln(w, "# TYPE simplenote_concurrency_rejected_total counter")
+	fmt.Fprintf(w, "simplenote_concurrency_rejected_total %d\n", concurrencyRejected.Load())
+	st := db.Stats()
+	fmt.Fprintln(w, "# TYPE simplenote_db_connections gauge")
+	fmt.Fprintf(w, "simplenote_db_connections{state=\"in_use\"} %d\n", st.InUse)
+	fmt.Fprintf(w, "simplenote_db_connections{state=\"idle\"} %d\n", st.Idle)
+	fmt.Fprintln(w, "# TYPE simplenote_db_connections_max gauge")
+	fmt.Fprintf(w, "simplenote_db_connections_max %d\n", st.MaxOpenConnections)
+	fmt.Fprintln(w, "# TYPE simplenote_db_wait_total counter")
+	fmt.Fprintf(w, "simplenote_db_wait_total %d\n", st.WaitCount)
+	fmt.Fprintln(w, "# TYPE simplenote_db_wait_seconds_total counter")
+	fmt.Fprintf(w, "simplenote_db_wait_seconds_total %g\n", st.WaitDuration.Seconds())
+	fmt.Fprintln(w, "# TYPE simplenote_sse_subscribers gauge")
+	fmt.Fprintf(w, "simplenote_sse_subscribers %d\n", events.count())
+	fmt.Fprintln(w, "# TYPE simplenote_sse_rejected_total counter")
+	fmt.Fprintf(w, "simplenote_sse_rejected_total %d\n", events.rejected.Load())
+	fmt.Fprintln(w, "# TYPE simplenote_heavy_ops_in_flight gauge")
+	fmt.Fprintf(w, "simplenote_heavy_ops_in_flight %d\n", heavyOps.inFlight())
+	fmt.Fprintln(w, "# TYPE simplenote_heavy_ops_rejected_total counter")
+	fmt.Fprintf(w, "simplenote_heavy_ops_rejected_total %d\n", heavyOps.rejected.Load())
+	fmt.Fprintln(w, "# TYPE simplenote_jobs_queued gauge")
+	fmt.Fprintf(w, "simplenote_jobs_queued %d\n", jobs.depth())
+	fmt.Fprintln(w, "# TYPE simplenote_jobs_running gauge")
+	fmt.Fprintf(w, "simplenote_jobs_running %d\n", jobs.running.Load())
+	fmt.Fprintln(w, "# TYPE simplenote_jobs_completed_total counter")
+	fmt.Fprintf(w, "simplenote_jobs_completed_total %d\n", jobs.completed.Load())
+	fmt.Fprintln(w, "# TYPE simplenote_jobs_failed_total counter")
+	fmt.Fprintf(w, "simplenote_jobs_failed_total %d\n", jobs.failed.Load())
+	fmt.Fprintln(w, "# TYPE simplenote_jobs_rejected_total counter")
+	fmt.Fprintf(w, "simplenote_jobs_rejected_total %d\n", jobs.rejected.Load())
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// Notebook groups notes; a note is in at most one. NoteCount counts the
+// notes in it that are not trashed.
+type Notebook struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	NoteCount int64      `json:"note_count"`
+}
+
+const maxNotebookName = 100
+
+const notebookColumns = "id, name, created_at, deleted_at"
+
+func notebookQuery(where string) string {
+	return "SELECT " + notebookColumns + ", (SELECT COUNT(*) FROM " + notesTable +
+		" n WHERE n.notebook_id = notebooks.id AND n.deleted_at IS NULL) FROM notebooks" + where
+}
+
+func scanNotebook(sc rowScanner) (Notebook, error) {
+	var nb Notebook
+	err := sc.Scan(&nb.ID, &nb.Name, &nb.CreatedAt, &nb.DeletedAt, &nb.NoteCount)
+	return nb, err
+}
+
+func validateNotebook(nb *Notebook) validationErrors {
+	errs := validationErrors{}
+	nb.Name = strings.TrimSpace(nb.Name)
+	if nb.Name == "" {
+		errs["name"] = "required"
+	} else if utf8.RuneCountInString(nb.Name) > maxNotebookName {
+		errs["name"] = "too long (max " + strconv.Itoa(maxNotebookName) + " characters)"
+	}
+	return errs
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+var errNoSuchNotebook = errors.New("no such notebook")
+
+// checkNotebook fails with errNoSuchNotebook unless id is nil or names a
+// notebook that is not in the trash. The notebook stays locked against
+// deletion until tx ends.
+func checkNotebook(tx *sql.Tx, id *int64) error {
+	if id == nil {
+		return nil
+	}
+	var found int64
+	err := tx.QueryRow("SELECT id FROM notebooks WHERE id = $1 AND deleted_at IS NULL FOR SHARE", *id).Scan(&found)
+	if err == sql.ErrNoRows {
+		return errNoSuchNotebook
+	}
+	return err
+}
+
+// isMissingNotebook reports whether a note write failed because its
+// notebook_id names no usable notebook.
+func isMissingNotebook(err error) bool {
+	return errors.Is(err, errNoSuchNotebook) || isForeignKeyViolation(err)
+}
+
+// handleNotebooks serves GET (list) and POST (create) on /api/notebooks.
+// The list leaves out deleted notebooks, unless trashed=true asks for only
+// those.
+func handleNotebooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		where := " WHERE deleted_at IS NULL"
+		if r.URL.Query().Get("trashed") == "true" {
+			where = " WHERE deleted_at IS NOT NULL"
+		}
+		defer observeQuery("list", time.Now())
+		var out []Notebook
+		err := retry(func() error {
+			out = []Notebook{}
+			rows, err := db.Query(notebookQuery(where + " ORDER BY name, id"))
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				nb, err := scanNotebook(rows)
+				if err != nil {
+					return err
+				}
+				out = append(out, nb)
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, out)
+	case http.MethodPost:
+		var in Notebook
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errs := validateNotebook(&in); len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		defer observeQuery("create", time.Now())
+		var nb Notebook
+		err := db.QueryRow("INSERT INTO notebooks (name, created_at) VALUES ($1, $2) RETURNING "+notebookColumns,
+			in.Name, clock.Now()).Scan(&nb.ID, &nb.Name, &nb.CreatedAt, &nb.DeletedAt)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/api/notebooks/"+strconv.FormatInt(nb.ID, 10))
+		writeJSON(w, http.StatusCreated, nb)
+	default:
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleNotebookByID serves GET, PUT (rename) and DELETE on
+// /api/notebooks/{id}, and POST /api/notebooks/{id}/move-notes and
+// /api/notebooks/{id}/restore. DELETE moves the notebook and its notes to
+// the trash; with hard=true it deletes the notebook for good and leaves its
+// notes outside any notebook.
+func handleNotebookByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path[len("/api/notebooks/"):], "/"), "/")
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		apiError(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if len(parts) == 2 && parts[1] == "move-notes" {
+		if r.Method != http.MethodPost {
+			apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		moveNotes(w, r, id)
+		return
+	}
+	if len(parts) == 2 && parts[1] == "restore" {
+		if r.Method != http.MethodPost {
+			apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		restoreNotebook(w, r, id)
+		return
+	}
+	if len(parts) != 1 {
+		notFound(w, r)
+		return
+	}
+	var nb Notebook
+	switch r.Method {
+	case http.MethodGet:
+		defer observeQuery("get", time.Now())
+		err = retry(func() error {
+			var err error
+			nb, err = scanNotebook(db.QueryRow(notebookQuery(" WHERE id = $1"), id))
+			return err
+		})
+	case http.MethodPut:
+		var in Notebook
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errs := validateNotebook(&in); len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		defer observeQuery("update", time.Now())
+		err = db.QueryRow("UPDATE notebooks SET name = $2 WHERE id = $1 AND deleted_at IS NULL RETURNING id", id, in.Name).Scan(&id)
+		if err == nil {
+			nb, err = scanNotebook(db.QueryRow(notebookQuery(" WHERE id = $1"), id))
+		}
+	case http.MethodDelete:
+		if r.URL.Query().Get("hard") == "true" {
+			hardDeleteNotebook(w, r, id)
+		} else {
+			trashNotebook(w, r, id)
+		}
+		return
+	default:
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, nb)
+}
+
+// moveNotes serves POST /api/notebooks/{id}/move-notes with {"ids": [...]}.
+// All listed notes move in one transaction, or none do if the notebook or
+// any of the notes does not exist. moved counts notes not already there.
+func moveNotes(w http.ResponseWriter, r *http.Request, id int64) {
+	var req struct {
+		IDs []noteKey `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		apiError(w, `body must be {"ids": [...]}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > maxBatchIDs {
+		apiError(w, "too many ids (max "+strconv.Itoa(maxBatchIDs)+")", http.StatusBadRequest)
+		return
+	}
+	defer observeQuery("update", time.Now())
+	ids, err := resolveNoteKeys(req.IDs)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	var moved []int64
+	var missing []noteKey
+	err = withTx(func(tx *sql.Tx) error {
+		// Locked so the notebook cannot be deleted under the move.
+		if err := tx.QueryRow("SELECT id FROM notebooks WHERE id = $1 AND deleted_at IS NULL FOR SHARE", id).Scan(&id); err != nil {
+			return err
+		}
+		found := map[int64]bool{}
+		err := collectIDs(tx, found,
+			"SELECT id FROM "+notesTable+" WHERE id = ANY($1) AND deleted_at IS NULL ORDER BY id FOR UPDATE",
+			pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		for i, nid := range ids {
+			if !found[nid] {
+				missing = append(missing, req.IDs[i])
+			}
+		}
+		if len(missing) > 0 {
+			return errUnknownNotes
+		}
+		set := map[int64]bool{}
+		err = collectIDs(tx, set, `
+			UPDATE `+notesTable+` SET notebook_id = $2, notebook_pinned = false, updated_at = $3
+			WHERE id = ANY($1) AND notebook_id IS DISTINCT FROM $2 RETURNING id
+		`, pq.Array(ids), id, clock.Now())
+		if err != nil {
+			return err
+		}
+		moved = sortedIDs(set)
+		return requestActor(r).audit(tx, "update", moved...)
+	})
+	switch {
+	case err == sql.ErrNoRows:
+		apiError(w, "notebook not found", http.StatusNotFound)
+	case errors.Is(err, errUnknownNotes):
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": err.Error(), "missing": missing})
+	case err != nil:
+		serverError(w, err)
+	default:
+		if len(moved) > 0 {
+			notesChanged()
+		}
+		for _, nid := range moved {
+			publishState("moved", nid, map[string]any{"notebook_id": id})
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"moved": len(moved)})
+	}
+}
+
+// hardDeleteNotebook deletes a notebook outright. Its notes are detached
+// explicitly rather than left to ON DELETE SET NULL, so they get a new
+// updated_at and an audit entry and show up in /changes.
+func hardDeleteNotebook(w http.ResponseWriter, r *http.Request, id int64) {
+	defer observeQuery("delete", time.Now())
+	detached := map[int64]bool{}
+	err := withTx(func(tx *sql.Tx) error {
+		if err := tx.QueryRow("SELECT id FROM notebooks WHERE id = $1 FOR UPDATE", id).Scan(&id); err != nil {
+			return err
+		}
+		err := collectIDs(tx, detached,
+			"UPDATE "+notesTable+" SET notebook_id = NULL, notebook_pinned = false, updated_at = $2 WHERE notebook_id = $1 RETURNING id",
+			id, clock.Now())
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM notebooks WHERE id = $1", id); err != nil {
+			return err
+		}
+		return requestActor(r).audit(tx, "update", sortedIDs(detached)...)
+	})
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	notesChanged()
+	for nid := range detached {
+		publishState("moved", nid, map[string]any{"notebook_id": nil})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// trashNotebook marks a notebook deleted and trashes its notes in the same
+// transaction, stamped with the same time so restoreNotebook can tell them
+// from notes that were trashed on their own.
+func trashNotebook(w http.ResponseWriter, r *http.Request, id int64) {
+	defer observeQuery("delete", time.Now())
+	now := clock.Now()
+	trashed := map[int64]bool{}
+	err := withTx(func(tx *sql.Tx) error {
+		if err := tx.QueryRow("UPDATE notebooks SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL RETURNING id", id, now).Scan(&id); err != nil {
+			return err
+		}
+		err := collectIDs(tx, trashed,
+			"UPDATE "+notesTable+" SET deleted_at = $2, updated_at = $2 WHERE notebook_id = $1 AND deleted_at IS NULL RETURNING id",
+			id, now)
+		if err != nil {
+			return err
+		}
+		return requestActor(r).audit(tx, "trash", sortedIDs(trashed)...)
+	})
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	notesChanged()
+	for nid := range trashed {
+		publishState("trashed", nid, map[string]any{"deleted_at": now})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreNotebook serves POST /api/notebooks/{id}/restore: the notebook
+// and the notes trashed along with it come back. Notes trashed before the
+// notebook stay in the trash, as do notes purged since. Nothing is restored
+// if the notes' pins would exceed maxPins.
+func restoreNotebook(w http.ResponseWriter, r *http.Request, id int64) {
+	defer observeQuery("update", time.Now())
+	restored := map[int64]bool{}
+	var nb Notebook
+	err := withTx(func(tx *sql.Tx) error {
+		var deletedAt *time.Time
+		if err := tx.QueryRow("SELECT deleted_at FROM notebooks WHERE id = $1 FOR UPDATE", id).Scan(&deletedAt); err != nil {
+			return err
+		}
+		if deletedAt == nil {
+			return errNotebookNotDeleted
+		}
+		if _, err := tx.Exec("UPDATE notebooks SET deleted_at = NULL WHERE id = $1", id); err != nil {
+			return err
+		}
+		err := collectIDs(tx, restored,
+			"UPDATE "+notesTable+" SET deleted_at = NULL, updated_at = $3 WHERE notebook_id = $1 AND deleted_at = $2 RETURNING id",
+			id, *deletedAt, clock.Now())
+		if err != nil {
+			return err
+		}
+		if err := checkPinTotal(tx); err != nil {
+			return err
+		}
+		if err := requestActor(r).audit(tx, "restore", sortedIDs(restored)...); err != nil {
+			return err
+		}
+		nb, err = scanNotebook(tx.QueryRow(notebookQuery(" WHERE id = $1"), id))
+		return err
+	})
+	switch {
+	case err == sql.ErrNoRows:
+		apiError(w, "not found", http.StatusNotFound)
+	case err == errNotebookNotDeleted, errors.Is(err, errPinLimit):
+		apiError(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		serverError(w, err)
+	default:
+		notesChanged()
+		for nid := range restored {
+			publishState("restored", nid, map[string]any{"deleted_at": nil})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"notebook": nb, "restored": len(restored)})
+	}
+}
+
+var errNotebookNotDeleted = errors.New("notebook is not deleted")
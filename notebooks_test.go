@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func createTestNotebook(t *testing.T, name string) Notebook {
+	t.Helper()
+	rec := doJSON(t, handleNotebooks, http.MethodPost, "/api/notebooks", map[string]string{"name": name})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create notebook: status %d: %s", rec.Code, rec.Body)
+	}
+	var nb Notebook
+	if err := json.Unmarshal(rec.Body.Bytes(), &nb); err != nil {
+		t.Fatal(err)
+	}
+	return nb
+}
+
+func TestNotebookTrashRestore(t *testing.T) {
+	testDB(t)
+	nb := createTestNotebook(t, "work")
+	path := "/api/notebooks/" + strconv.FormatInt(nb.ID, 10)
+	kept := createTestNote(t, Note{Title: "kept", Body: "x", NotebookID: &nb.ID})
+	early := createTestNote(t, Note{Title: "early", Body: "x", NotebookID: &nb.ID})
+	other := createTestNote(t, Note{Title: "other", Body: "x"})
+	if _, err := db.Exec("UPDATE "+notesTable+" SET deleted_at = $2 WHERE id = $1", early.ID, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := doJSON(t, handleNotebookByID, http.MethodDelete, path, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("trash: status %d: %s", rec.Code, rec.Body)
+	}
+	if n := countNotes(t, "id = $1 AND deleted_at IS NOT NULL", kept.ID); n != 1 {
+		t.Error("note not trashed with its notebook")
+	}
+	if n := countNotes(t, "id = $1 AND deleted_at IS NULL", other.ID); n != 1 {
+		t.Error("note outside the notebook was trashed")
+	}
+
+	rec := doJSON(t, handleNotebookByID, http.MethodPost, path+"/restore", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore: status %d: %s", rec.Code, rec.Body)
+	}
+	var out struct {
+		Notebook Notebook `json:"notebook"`
+		Restored int      `json:"restored"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Restored != 1 || out.Notebook.DeletedAt != nil {
+		t.Errorf("restore = %+v, want one note and a live notebook", out)
+	}
+	if n := countNotes(t, "id = $1 AND deleted_at IS NULL", kept.ID); n != 1 {
+		t.Error("note trashed with the notebook was not restored")
+	}
+	if n := countNotes(t, "id = $1 AND deleted_at IS NOT NULL", early.ID); n != 1 {
+		t.Error("note trashed before the notebook was restored")
+	}
+
+	if rec := doJSON(t, handleNotebookByID, http.MethodPost, path+"/restore", nil); rec.Code != http.StatusConflict {
+		t.Errorf("restoring a live notebook: status %d, want 409", rec.Code)
+	}
+}
+
+func TestHardDeleteNotebookDetachesNotes(t *testing.T) {
+	testDB(t)
+	nb := createTestNotebook(t, "scratch")
+	n := createTestNote(t, Note{Title: "loose", Body: "x", NotebookID: &nb.ID})
+	if _, err := db.Exec("UPDATE "+notesTable+" SET updated_at = $2 WHERE id = $1", n.ID, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/notebooks/" + strconv.FormatInt(nb.ID, 10) + "?hard=true"
+	if rec := doJSON(t, handleNotebookByID, http.MethodDelete, path, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("hard delete: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := countNotes(t, "id = $1 AND notebook_id IS NULL AND updated_at > $2", n.ID, time.Now().Add(-time.Minute)); got != 1 {
+		t.Error("note not detached with a new updated_at")
+	}
+	if rec := doJSON(t, handleNotebookByID, http.MethodDelete, path, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("deleting a missing notebook: status %d, want 404", rec.Code)
+	}
+}
+
+func TestRestoreNotebookPinLimit(t *testing.T) {
+	testDB(t)
+	saved := maxPins
+	defer func() { maxPins = saved }()
+	maxPins = 1
+	nb := createTestNotebook(t, "pins")
+	path := "/api/notebooks/" + strconv.FormatInt(nb.ID, 10)
+	inside := createTestNote(t, Note{Title: "inside", Body: "x", Pinned: true, NotebookID: &nb.ID})
+	if rec := doJSON(t, handleNotebookByID, http.MethodDelete, path, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("trash: status %d", rec.Code)
+	}
+	createTestNote(t, Note{Title: "outside", Body: "x", Pinned: true})
+	if rec := doJSON(t, handleNotebookByID, http.MethodPost, path+"/restore", nil); rec.Code != http.StatusConflict {
+		t.Errorf("restore past the pin limit: status %d, want 409", rec.Code)
+	}
+	if n := countNotes(t, "id = $1 AND deleted_at IS NOT NULL", inside.ID); n != 1 {
+		t.Error("note restored past the pin limit")
+	}
+}
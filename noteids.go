@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// uuidIDs makes the note UUID the only id accepted in /api/notes/{id}
+// paths and used in note links (NOTE_IDS=uuid). Integer ids are
+// sequential, so they reveal how many notes exist and are easy to guess.
+var uuidIDs bool
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// resolveNoteID maps a path segment to the note's integer id. UUIDs are
+// always accepted; integers only when uuidIDs is off. ok is false when the
+// segment names no note.
+func resolveNoteID(w http.ResponseWriter, seg string) (id int64, ok bool) {
+	if !uuidRe.MatchString(seg) {
+		id, err := strconv.ParseInt(seg, 10, 64)
+		if err != nil {
+			apiError(w, "bad request", http.StatusBadRequest)
+			return 0, false
+		}
+		if uuidIDs {
+			apiError(w, "not found", http.StatusNotFound)
+			return 0, false
+		}
+		return id, true
+	}
+	err := retry(func() error {
+		return db.QueryRow("SELECT id FROM "+notesTable+" WHERE uuid = $1", seg).Scan(&id)
+	})
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return 0, false
+	}
+	if err != nil {
+		serverError(w, err)
+		return 0, false
+	}
+	return id, true
+}
+
+// noteKey is a note id as a client sends it in a body or a query: the
+// integer id, or the UUID. Bodies may give either as a JSON string, or the
+// integer as a number.
+type noteKey string
+
+func parseNoteKey(s string) (noteKey, error) {
+	s = strings.TrimSpace(s)
+	if uuidRe.MatchString(s) {
+		return noteKey(strings.ToLower(s)), nil
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+		return "", fmt.Errorf("invalid id %q", s)
+	}
+	return noteKey(s), nil
+}
+
+func (k *noteKey) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n json.Number
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("invalid id %s", b)
+		}
+		s = n.String()
+	}
+	key, err := parseNoteKey(s)
+	*k = key
+	return err
+}
+
+// MarshalJSON echoes integer ids as numbers and UUIDs as strings.
+func (k noteKey) MarshalJSON() ([]byte, error) {
+	if k == "" || uuidRe.MatchString(string(k)) {
+		return json.Marshal(string(k))
+	}
+	return []byte(k), nil
+}
+
+// splitNoteKeys sorts keys into integer ids and UUIDs. Integer ids are
+// dropped when uuidIDs is on, as resolveNoteID refuses them.
+func splitNoteKeys(keys []noteKey) (ids []int64, uuids []string) {
+	for _, k := range keys {
+		if uuidRe.MatchString(string(k)) {
+			uuids = append(uuids, string(k))
+		} else if id, err := strconv.ParseInt(string(k), 10, 64); err == nil && !uuidIDs {
+			ids = append(ids, id)
+		}
+	}
+	return ids, uuids
+}
+
+// resolveNoteKeys maps keys to integer note ids, in order, with one query
+// for the UUIDs. A key that names no note maps to 0, which no note has, so
+// callers report it like any other unknown id.
+func resolveNoteKeys(keys []noteKey) ([]int64, error) {
+	_, uuids := splitNoteKeys(keys)
+	byUUID := map[string]int64{}
+	if len(uuids) > 0 {
+		err := retry(func() error {
+			rows, err := db.Query("SELECT uuid::text, id FROM "+notesTable+" WHERE uuid = ANY($1::uuid[])", pq.Array(uuids))
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var u string
+				var id int64
+				if err := rows.Scan(&u, &id); err != nil {
+					return err
+				}
+				byUUID[u] = id
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	ids := make([]int64, len(keys))
+	for i, k := range keys {
+		if id, ok := byUUID[string(k)]; ok {
+			ids[i] = id
+		} else if id, err := strconv.ParseInt(string(k), 10, 64); err == nil && !uuidIDs {
+			ids[i] = id
+		}
+	}
+	return ids, nil
+}
+
+// noteRef is the id used for n in paths and links.
+func noteRef(n Note) string {
+	if uuidIDs {
+		return n.UUID
+	}
+	return strconv.FormatInt(n.ID, 10)
+}
+
+// publicFields is the projection for notes served to anonymous readers:
+// everything but the integer id when uuidIDs is on, nil otherwise.
+func publicFields() []string {
+	if !uuidIDs {
+		return nil
+	}
+	var fields []string
+	for f := range projectable {
+		if f != "id" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestNoteKeyJSON(t *testing.T) {
+	const u = "0F8FAD5B-D9CB-469F-A165-70867728950E"
+	tests := []struct {
+		in      string
+		want    noteKey
+		out     string
+		wantErr bool
+	}{
+		{`42`, "42", `42`, false},
+		{`"42"`, "42", `42`, false},
+		{`"` + u + `"`, "0f8fad5b-d9cb-469f-a165-70867728950e", `"0f8fad5b-d9cb-469f-a165-70867728950e"`, false},
+		{`"abc"`, "", "", true},
+		{`1.5`, "", "", true},
+		{`true`, "", "", true},
+	}
+	for _, tt := range tests {
+		var k noteKey
+		err := json.Unmarshal([]byte(tt.in), &k)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unmarshal %s: err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if k != tt.want {
+			t.Errorf("unmarshal %s = %q, want %q", tt.in, k, tt.want)
+		}
+		b, err := json.Marshal(k)
+		if err != nil || string(b) != tt.out {
+			t.Errorf("marshal %q = %s, %v; want %s", k, b, err, tt.out)
+		}
+	}
+}
+
+func TestParseIDList(t *testing.T) {
+	const u = "0f8fad5b-d9cb-469f-a165-70867728950e"
+	tests := []struct {
+		ids     string
+		want    []noteKey
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"1,2", []noteKey{"1", "2"}, false},
+		{"3," + u, []noteKey{"3", u}, false},
+		{"1,x", nil, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/notes?ids="+tt.ids, nil)
+		got, err := parseIDList(r)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ids=%s: err = %v, wantErr %v", tt.ids, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ids=%s = %q, want %q", tt.ids, got, tt.want)
+		}
+	}
+}
+
+func TestBatchEndpointsAcceptUUIDs(t *testing.T) {
+	testDB(t)
+	a := createTestNote(t, Note{Title: "a", Body: "one"})
+	b := createTestNote(t, Note{Title: "b", Body: "two"})
+	const unknown = "0f8fad5b-d9cb-469f-a165-70867728950e"
+
+	rec := doJSON(t, handleNoteStatus, http.MethodPost, "/api/notes/status", map[string]any{"ids": []any{a.UUID, b.ID, unknown}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: %d: %s", rec.Code, rec.Body)
+	}
+	var st []struct {
+		ID     any  `json:"id"`
+		Exists bool `json:"exists"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if len(st) != 3 || st[0].ID != a.UUID || !st[0].Exists || st[1].ID != float64(b.ID) || !st[1].Exists || st[2].Exists {
+		t.Errorf("status = %+v, want a by UUID, b by id, and the unknown UUID missing", st)
+	}
+
+	rec = doJSON(t, handleBulkTag, http.MethodPost, "/api/notes/bulk-tag", map[string]any{"ids": []string{a.UUID}, "add": []string{"uuid"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bulk-tag: %d: %s", rec.Code, rec.Body)
+	}
+	if n := countNotes(t, "id = $1 AND 'uuid' = ANY(tags)", a.ID); n != 1 {
+		t.Error("bulk-tag by UUID did not tag the note")
+	}
+
+	rec = doJSON(t, handleDiff, http.MethodGet, "/api/notes/diff?a="+a.UUID+"&b="+strconv.FormatInt(b.ID, 10), nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("diff by UUID: status %d: %s", rec.Code, rec.Body)
+	}
+	rec = doJSON(t, handleDiff, http.MethodGet, "/api/notes/diff?a="+unknown+"&b="+a.UUID, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("diff with an unknown UUID: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var notFoundTpl *template.Template
+
+// loadNotFoundPage parses the 404 page: the file named by NOT_FOUND_PAGE
+// if set, otherwise the embedded static/404.html. Like the index page it
+// is a template rendered with the page data.
+func loadNotFoundPage() *template.Template {
+	var b []byte
+	var err error
+	if p := os.Getenv("NOT_FOUND_PAGE"); p != "" {
+		b, err = os.ReadFile(p)
+	} else {
+		b, err = staticFS.ReadFile("static/404.html")
+	}
+	if err != nil {
+		log.Fatal("404 page:", err)
+	}
+	return template.Must(template.New("404").Parse(string(b)))
+}
+
+// notFound answers an unknown route: JSON for API paths and clients that
+// ask for JSON, the HTML 404 page for everyone else.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found", "request_id": requestID(r)})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	notFoundTpl.Execute(w, indexData)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// queryInt reads an integer query parameter. Missing or malformed values
+// yield def; values outside [lo, hi], overflowing ones included, are
+// clamped.
+func queryInt(r *http.Request, key string, def, lo, hi int) int {
+	v := strings.TrimSpace(r.URL.Query().Get(key))
+	if v == "" {
+		return def
+	}
+	// On overflow Atoi returns the largest or smallest int along with
+	// ErrRange, which the clamp below brings into range.
+	n, err := strconv.Atoi(v)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return def
+	}
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
+
+// pagination returns the LIMIT/OFFSET suffix for a list query. The limit
+// defaults to defaultPageSize and never exceeds maxPageSize.
+func pagination(r *http.Request, c *whereClause) string {
+	limit := queryInt(r, "limit", defaultPageSize, 1, maxPageSize)
+	offset := queryInt(r, "offset", 0, 0, math.MaxInt32)
+	return " LIMIT " + c.arg(limit) + " OFFSET " + c.arg(offset)
+}
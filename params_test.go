@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestQueryInt(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        int
+	}{
+		{"missing", "", 10},
+		{"valid", "5", 5},
+		{"spaces", " 7 ", 7},
+		{"at lower bound", "1", 1},
+		{"at upper bound", "100", 100},
+		{"negative", "-3", 1},
+		{"zero", "0", 1},
+		{"above upper bound", "101", 100},
+		{"overflowing", "99999999999999999999", 100},
+		{"negative overflowing", "-99999999999999999999", 1},
+		{"malformed", "abc", 10},
+		{"fraction", "1.5", 10},
+		{"trailing junk", "5x", 10},
+		{"hex", "0x10", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/notes?n="+url.QueryEscape(tt.value), nil)
+			if got := queryInt(r, "n", 10, 1, 100); got != tt.want {
+				t.Errorf("queryInt(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"1w2d", 9 * 24 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{" 3d ", 3 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"-1d", 0, true},
+		{"-1h", 0, true},
+		{"99999999999999999999d", 0, true},
+		{"abc", 0, true},
+		{"d", 0, true},
+		{"1x", 0, true},
+		{"1.5d", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAge(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseAge(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		query         string
+		limit, offset int
+	}{
+		{"", defaultPageSize, 0},
+		{"limit=10", 10, 0},
+		{"limit=10&offset=20", 10, 20},
+		{"limit=abc", defaultPageSize, 0},
+		{"limit=0", 1, 0},
+		{"limit=100000", maxPageSize, 0},
+		{"limit=99999999999999999999", maxPageSize, 0},
+		{"offset=-5", defaultPageSize, 0},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/notes?"+tt.query, nil)
+		var c whereClause
+		if got := pagination(r, &c); got != " LIMIT $1 OFFSET $2" {
+			t.Errorf("%q: pagination = %q", tt.query, got)
+			continue
+		}
+		if c.args[0] != tt.limit || c.args[1] != tt.offset {
+			t.Errorf("%q: limit, offset = %v, %v, want %d, %d", tt.query, c.args[0], c.args[1], tt.limit, tt.offset)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const mergePatchType = "application/merge-patch+json"
+
+// patchNote applies an RFC 7396 merge patch: members present are set,
+// members set to null are cleared and absent members are left alone.
+// Attachments are the exception: as on PUT, those given are added, and
+// "attachments": null is refused since a patch cannot delete them.
+func patchNote(w http.ResponseWriter, r *http.Request, id int64) {
+	limitBody(w, r)
+	if !checkJSONBody(w, r) {
+		return
+	}
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		if !bodyTooLarge(w, err) {
+			apiError(w, "merge patch must be a JSON object", http.StatusBadRequest)
+		}
+		return
+	}
+	defer observeQuery("update", time.Now())
+	tx, err := beginTx()
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	defer tx.Rollback()
+	cur, err := scanNote(tx.QueryRow("SELECT "+noteColumns+" FROM "+notesTable+" WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id))
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	in, err := applyMergePatch(cur, patch)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	storeUpdate(w, r, tx, id, in)
+}
+
+func applyMergePatch(n Note, patch map[string]json.RawMessage) (Note, error) {
+	for key, raw := range patch {
+		var dst any
+		switch key {
+		case "title":
+			dst = &n.Title
+		case "body":
+			dst = &n.Body
+		case "tags":
+			dst = &n.Tags
+		case "pinned":
+			dst = &n.Pinned
+		case "pin_position":
+			dst = &n.PinPosition
+		case "public":
+			dst = &n.Public
+		case "notebook_id":
+			dst = &n.NotebookID
+		case "publish_at":
+			dst = &n.PublishAt
+		case "language":
+			dst = &n.Language
+		case "export_format":
+			dst = &n.ExportFormat
+		case "format":
+			dst = &n.Format
+		case "attachments":
+			if isJSONNull(raw) {
+				return n, fmt.Errorf("attachments cannot be cleared by a merge patch")
+			}
+			dst = &n.Attachments
+		case "content_json":
+			// Stored as given; null clears it.
+			n.ContentJSON = append(json.RawMessage(nil), raw...)
+			continue
+		case "metadata":
+			m, err := mergeMetadata(n.Metadata, raw)
+			if err != nil {
+				return n, fmt.Errorf("invalid metadata: %v", err)
+			}
+			n.Metadata = m
+			continue
+		case "id", "uuid", "external_id", "notebook_pinned", "snoozed_until", "created_at", "updated_at", "deleted_at", "position", "created_relative", "warnings", "upsert",
+			"revision_match", "purge_at", "seconds_until_purge":
+			continue
+		default:
+			return n, fmt.Errorf("unknown field %q", key)
+		}
+		if isJSONNull(raw) {
+			// Unmarshalling null leaves values untouched, so clear explicitly.
+			switch d := dst.(type) {
+			case *string:
+				*d = ""
+			case *bool:
+				*d = false
+			case *[]string:
+				*d = []string{}
+			case **int64:
+				*d = nil
+			case **time.Time:
+				*d = nil
+			case **string:
+				*d = nil
+			}
+			continue
+		}
+		if err := json.Unmarshal(raw, dst); err != nil {
+			return n, fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
+	return n, nil
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	cur := Note{Title: "t", Body: "b", Tags: []string{"x"}, Pinned: true}
+	tests := []struct {
+		patch   string
+		check   func(Note) bool
+		wantErr bool
+	}{
+		{`{"title": "new"}`, func(n Note) bool { return n.Title == "new" && n.Body == "b" }, false},
+		{`{"tags": null, "pinned": null}`, func(n Note) bool { return len(n.Tags) == 0 && !n.Pinned }, false},
+		{`{"attachments": [{"filename": "a.txt", "data_base64": "eA=="}]}`, func(n Note) bool { return len(n.Attachments) == 1 }, false},
+		{`{"attachments": null}`, nil, true},
+		{`{"bogus": 1}`, nil, true},
+	}
+	for _, tt := range tests {
+		var patch map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		got, err := applyMergePatch(cur, patch)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.patch, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !tt.check(got) {
+			t.Errorf("%s: got %+v", tt.patch, got)
+		}
+	}
+}
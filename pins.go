@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxPins caps the number of pinned notes; 0 disables the limit.
+var maxPins = 10
+
+var errPinLimit = errors.New("pin limit reached")
+
+// pinLockKey serializes pin limit checks across concurrent transactions.
+const pinLockKey = 0x706e6e73
+
+// checkPinLimit fails with errPinLimit if pinning note id would exceed
+// maxPins. Pass id 0 for a note that does not exist yet.
+func checkPinLimit(tx *sql.Tx, id int64) error {
+	if maxPins <= 0 {
+		return nil
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", pinLockKey); err != nil {
+		return err
+	}
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM "+notesTable+" WHERE pinned AND id <> $1 AND deleted_at IS NULL", id).Scan(&count); err != nil {
+		return err
+	}
+	if count >= maxPins {
+		return fmt.Errorf("%w (%d): unpin a note first", errPinLimit, maxPins)
+	}
+	return nil
+}
+
+// checkPinTotal fails with errPinLimit if more than maxPins live notes are
+// pinned, for writes such as restoring a notebook that bring back several
+// pinned notes at once. Run it after the write, in the same transaction.
+func checkPinTotal(tx *sql.Tx) error {
+	if maxPins <= 0 {
+		return nil
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", pinLockKey); err != nil {
+		return err
+	}
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM " + notesTable + " WHERE pinned AND deleted_at IS NULL").Scan(&count); err != nil {
+		return err
+	}
+	if count > maxPins {
+		return fmt.Errorf("%w (%d): unpin a note first", errPinLimit, maxPins)
+	}
+	return nil
+}
+
+// pinNote pins a note, optionally at {"position": n} among the pins.
+func pinNote(w http.ResponseWriter, r *http.Request, id int64) {
+	var req struct {
+		Position *int64 `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	setPinned(w, r, id, true, req.Position)
+}
+
+func unpinNote(w http.ResponseWriter, r *http.Request, id int64) {
+	setPinned(w, r, id, false, nil)
+}
+
+func setPinned(w http.ResponseWriter, r *http.Request, id int64, pinned bool, position *int64) {
+	defer observeQuery("update", time.Now())
+	var n Note
+	err := withTx(func(tx *sql.Tx) error {
+		if pinned {
+			if err := checkPinLimit(tx, id); err != nil {
+				return err
+			}
+		}
+		var err error
+		n, err = scanNote(tx.QueryRow(
+			"UPDATE "+notesTable+" SET pinned = $2, pin_position = $3, updated_at = $4 WHERE id = $1 AND deleted_at IS NULL RETURNING "+noteColumns,
+			id, pinned, position, clock.Now(),
+		))
+		if err != nil {
+			return err
+		}
+		return requestActor(r).audit(tx, "update", n.ID)
+	})
+	switch {
+	case err == sql.ErrNoRows:
+		apiError(w, "not found", http.StatusNotFound)
+	case errors.Is(err, errPinLimit):
+		apiError(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		serverError(w, err)
+	default:
+		notesChanged()
+		typ := "unpinned"
+		if pinned {
+			typ = "pinned"
+		}
+		publishState(typ, n.ID, map[string]any{"pinned": n.Pinned, "pin_position": n.PinPosition})
+		writeNoteJSON(w, r, http.StatusOK, n)
+	}
+}
+
+var errNoNotebook = errors.New("note is not in a notebook")
+
+// setNotebookPinned pins or unpins a note within its notebook. Notebook
+// pins only float in lists filtered to that notebook, where they come
+// before global pins; they do not count against maxPins. Moving the note to
+// another notebook unpins it there.
+func setNotebookPinned(w http.ResponseWriter, r *http.Request, id int64, pinned bool) {
+	defer observeQuery("update", time.Now())
+	var n Note
+	err := withTx(func(tx *sql.Tx) error {
+		var notebook *int64
+		err := tx.QueryRow("SELECT notebook_id FROM "+notesTable+" WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&notebook)
+		if err != nil {
+			return err
+		}
+		if pinned && notebook == nil {
+			return errNoNotebook
+		}
+		n, err = scanNote(tx.QueryRow(
+			"UPDATE "+notesTable+" SET notebook_pinned = $2, updated_at = $3 WHERE id = $1 RETURNING "+noteColumns,
+			id, pinned, clock.Now(),
+		))
+		if err != nil {
+			return err
+		}
+		return requestActor(r).audit(tx, "update", n.ID)
+	})
+	switch {
+	case err == sql.ErrNoRows:
+		apiError(w, "not found", http.StatusNotFound)
+	case err == errNoNotebook:
+		apiError(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		serverError(w, err)
+	default:
+		notesChanged()
+		publishState("notebook_pin", n.ID, map[string]any{"notebook_pinned": n.NotebookPinned, "notebook_id": n.NotebookID})
+		writeNoteJSON(w, r, http.StatusOK, n)
+	}
+}
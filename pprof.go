@@ -0,0 +1,16 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// registerPprof serves the runtime profiles under /debug/pprof/, behind the
+// same ADMIN_TOKEN check as the admin routes.
+func registerPprof(mux *http.ServeMux) {
+	mux.Handle("/debug/pprof/", requireAdmin(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", requireAdmin(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", requireAdmin(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", requireAdmin(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", requireAdmin(http.HandlerFunc(pprof.Trace)))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// preferredReturn reports the return preference from an RFC 7240 Prefer
+// header: "minimal", "representation" or "" when none was sent.
+func preferredReturn(r *http.Request) string {
+	for _, h := range r.Header.Values("Prefer") {
+		for _, p := range strings.Split(h, ",") {
+			p, _, _ = strings.Cut(p, ";")
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.EqualFold(k, "return") {
+				v = strings.ToLower(strings.Trim(strings.TrimSpace(v), `"`))
+				if v == "minimal" || v == "representation" {
+					return v
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// writeNote answers a create or update with the stored note, or with only a
+// Location header when the client sent Prefer: return=minimal.
+func writeNote(w http.ResponseWriter, r *http.Request, status int, n Note) {
+	w.Header().Set("Location", "/api/notes/"+noteRef(n))
+	pref := preferredReturn(r)
+	if pref != "" {
+		w.Header().Set("Preference-Applied", "return="+pref)
+	}
+	if pref == "minimal" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeNoteJSON(w, r, status, n)
+}
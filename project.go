@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// projectable lists the note fields ?select= may pick.
+var projectable = map[string]bool{
+	"id": true, "uuid": true, "external_id": true, "title": true, "body": true, "tags": true, "pinned": true,
+	"pin_position": true, "public": true, "position": true, "metadata": true,
+	"content_json": true, "created_at": true, "updated_at": true,
+	"deleted_at": true, "created_relative": true, "attachments": true,
+	"revision_match": true, "notebook_id": true, "notebook_pinned": true, "publish_at": true,
+	"language": true, "format": true, "export_format": true, "snoozed_until": true, "purge_at": true, "seconds_until_purge": true,
+}
+
+// searchScope returns the search scope for q: search_fields, or its older
+// name fields. Both only ever name the scope; the projection is ?select=.
+func searchScope(r *http.Request) string {
+	qs := r.URL.Query()
+	if v := qs.Get("search_fields"); v != "" {
+		return v
+	}
+	return qs.Get("fields")
+}
+
+// projection parses ?select=id,title,... into the set of note fields to
+// return; nil means all of them.
+func projection(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("select")
+	if v == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if !projectable[f] {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// project keeps only fields of each note. Notes are read whole either way;
+// the point is a smaller response.
+func project(notes []Note, fields []string) ([]map[string]json.RawMessage, error) {
+	out := make([]map[string]json.RawMessage, len(notes))
+	for i, n := range notes {
+		b, err := json.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(b, &all); err != nil {
+			return nil, err
+		}
+		m := make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				m[f] = v
+			}
+		}
+		out[i] = m
+	}
+	return out, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSearchScopeAndProjection(t *testing.T) {
+	tests := []struct {
+		query   string
+		scope   string
+		fields  []string
+		wantErr bool
+	}{
+		{"", "", nil, false},
+		{"q=x&fields=title", "title", nil, false},
+		{"q=x&search_fields=body&fields=title", "body", nil, false},
+		{"select=id,title", "", []string{"id", "title"}, false},
+		{"q=x&fields=body&select=title", "body", []string{"title"}, false},
+		{"select=id,nope", "", nil, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/notes?"+tt.query, nil)
+		if got := searchScope(r); got != tt.scope {
+			t.Errorf("%s: scope = %q, want %q", tt.query, got, tt.scope)
+		}
+		fields, err := projection(r)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: projection = %q, want %q", tt.query, fields, tt.fields)
+		}
+	}
+}
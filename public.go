@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// setPublic handles PUT /api/notes/{id}/public with {"public": bool}.
+func setPublic(w http.ResponseWriter, r *http.Request, id int64) {
+	var req struct {
+		Public *bool `json:"public"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Public == nil {
+		apiError(w, `body must be {"public": true|false}`, http.StatusBadRequest)
+		return
+	}
+	start := time.Now()
+	var n Note
+	err := withTx(func(tx *sql.Tx) error {
+		var err error
+		n, err = scanNote(tx.QueryRow(
+			"UPDATE "+notesTable+" SET public = $2, updated_at = $3 WHERE id = $1 AND deleted_at IS NULL RETURNING "+noteColumns,
+			id, *req.Public, clock.Now()))
+		if err != nil {
+			return err
+		}
+		return requestActor(r).audit(tx, "update", n.ID)
+	})
+	observeQuery("update", start)
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	notesChanged()
+	publishState("visibility", n.ID, map[string]any{"public": n.Public})
+	writeNoteJSON(w, r, http.StatusOK, n)
+}
+
+// handlePublicNotes lists notes marked public. It needs no credentials.
+func handlePublicNotes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	where := &whereClause{}
+	where.add("public")
+	where.add("deleted_at IS NULL")
+	where.add(published(where))
+	start := time.Now()
+	notes, err := queryNotes("SELECT "+noteColumns+" FROM "+notesTable+where.String()+
+		" ORDER BY created_at DESC, id DESC"+pagination(r, where), where.args...)
+	observeQuery("list", start)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	list, err := renderNotes(r, notes, publicFields())
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// readOnly puts the server in maintenance mode: writes are refused with 503
+// while reads go on. It starts from READ_ONLY and can be flipped at
+// /admin/read-only.
+var readOnly atomic.Bool
+
+// readOnlyExempt are the non-GET routes that write nothing, or that must
+// keep working to leave maintenance mode.
+var readOnlyExempt = map[string]bool{
+	"/api/notes/validate": true,
+	"/api/notes/status":   true,
+	"/admin/stats/reset":  true,
+	"/admin/read-only":    true,
+}
+
+func refuseWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if readOnly.Load() && !readOnlyExempt[r.URL.Path] {
+				w.Header().Set("Retry-After", "60")
+				httpError(w, r, "service is in read-only maintenance mode", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleReadOnly serves /admin/read-only: GET reports the mode, PUT
+// {"read_only": bool} sets it.
+func handleReadOnly(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			ReadOnly *bool `json:"read_only"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ReadOnly == nil {
+			http.Error(w, `body must be {"read_only": true|false}`, http.StatusBadRequest)
+			return
+		}
+		readOnly.Store(*req.ReadOnly)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"read_only": readOnly.Load()})
+}
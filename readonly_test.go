@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRefuseWrites(t *testing.T) {
+	readOnly.Store(true)
+	defer readOnly.Store(false)
+	h := refuseWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/notes", http.StatusOK},
+		{http.MethodPost, "/api/notes", http.StatusServiceUnavailable},
+		{http.MethodPost, "/api/notes/status", http.StatusOK},
+		{http.MethodPost, "/api/notes/validate", http.StatusOK},
+		{http.MethodPut, "/admin/read-only", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var relativeUnits = []struct {
+	name string
+	size time.Duration
+}{
+	{"year", 365 * 24 * time.Hour},
+	{"month", 30 * 24 * time.Hour},
+	{"week", 7 * 24 * time.Hour},
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+	{"second", time.Second},
+}
+
+// relativeTime describes t relative to now in the largest whole unit, e.g.
+// "3 hours ago" or "in 2 days". Anything under a second is "just now".
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	for _, u := range relativeUnits {
+		if d < u.size {
+			continue
+		}
+		n := int64(d / u.size)
+		s := strconv.FormatInt(n, 10) + " " + u.name
+		if n != 1 {
+			s += "s"
+		}
+		if future {
+			return "in " + s
+		}
+		return s + " ago"
+	}
+	return "just now"
+}
+
+// addRelative fills CreatedRelative when the request asks for relative=true.
+func addRelative(r *http.Request, notes []Note) {
+	if r.URL.Query().Get("relative") != "true" {
+		return
+	}
+	now := clock.Now()
+	for i := range notes {
+		notes[i].CreatedRelative = relativeTime(notes[i].CreatedAt, now)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{0, "just now"},
+		{999 * time.Millisecond, "just now"},
+		{time.Second, "1 second ago"},
+		{59 * time.Second, "59 seconds ago"},
+		{60 * time.Second, "1 minute ago"},
+		{119 * time.Second, "1 minute ago"},
+		{59 * time.Minute, "59 minutes ago"},
+		{time.Hour, "1 hour ago"},
+		{23 * time.Hour, "23 hours ago"},
+		{24*time.Hour - time.Second, "23 hours ago"},
+		{24 * time.Hour, "1 day ago"},
+		{6 * 24 * time.Hour, "6 days ago"},
+		{7 * 24 * time.Hour, "1 week ago"},
+		{30 * 24 * time.Hour, "1 month ago"},
+		{365 * 24 * time.Hour, "1 year ago"},
+		{-500 * time.Millisecond, "just now"},
+		{-time.Second, "in 1 second"},
+		{-60 * time.Second, "in 1 minute"},
+		{-24 * time.Hour, "in 1 day"},
+		{-48 * time.Hour, "in 2 days"},
+	}
+	for _, tt := range tests {
+		if got := relativeTime(now.Add(-tt.ago), now); got != tt.want {
+			t.Errorf("relativeTime(now - %s) = %q, want %q", tt.ago, got, tt.want)
+		}
+	}
+}
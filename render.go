@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// noteFormats are the values of a note's format: how its body is written
+// and so how it is rendered.
+var noteFormats = map[string]func(string) string{
+	"plain":    renderPlain,
+	"markdown": renderMarkdown,
+	"html":     sanitizeHTML,
+}
+
+const noteFormatNames = "plain, markdown, html"
+
+func normalizeFormat(n *Note) {
+	n.Format = strings.ToLower(strings.TrimSpace(n.Format))
+	if n.Format == "" {
+		n.Format = "plain"
+	}
+}
+
+// renderNoteBody serves GET /api/notes/{id}/render: the body as an HTML
+// fragment, processed according to the note's format.
+func renderNoteBody(w http.ResponseWriter, r *http.Request, id int64) {
+	defer observeQuery("get", time.Now())
+	var n Note
+	err := retry(func() error {
+		var err error
+		n, err = scanNote(db.QueryRow("SELECT "+noteColumns+" FROM "+notesTable+" WHERE id = $1 AND deleted_at IS NULL", id))
+		return err
+	})
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	render := noteFormats[n.Format]
+	if render == nil {
+		render = renderPlain
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src https: data:; style-src 'unsafe-inline'")
+	w.Header().Set("X-Note-Format", n.Format)
+	w.Write([]byte(render(n.Body)))
+}
+
+// renderPlain escapes body, making paragraphs of blank-line separated text
+// and keeping single line breaks.
+func renderPlain(body string) string {
+	var b strings.Builder
+	for _, para := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n\n") {
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+		lines := strings.Split(strings.Trim(para, "\n"), "\n")
+		for i, l := range lines {
+			lines[i] = html.EscapeString(l)
+		}
+		b.WriteString("<p>" + strings.Join(lines, "<br>\n") + "</p>\n")
+	}
+	return b.String()
+}
+
+// allowedTags are the elements kept by sanitizeHTML, with the attributes
+// each may keep. Other elements are dropped but their text is kept, except
+// for droppedTags, whose content goes too.
+var allowedTags = map[atom.Atom][]string{
+	atom.P: nil, atom.Br: nil, atom.Hr: nil, atom.Div: nil, atom.Span: nil,
+	atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil,
+	atom.Strong: nil, atom.B: nil, atom.Em: nil, atom.I: nil, atom.U: nil, atom.S: nil, atom.Del: nil,
+	atom.Sub: nil, atom.Sup: nil, atom.Code: nil, atom.Pre: nil, atom.Blockquote: nil,
+	atom.Ul: nil, atom.Ol: nil, atom.Li: nil,
+	atom.Table: nil, atom.Thead: nil, atom.Tbody: nil, atom.Tr: nil, atom.Th: nil, atom.Td: nil,
+	atom.A:   {"href", "title"},
+	atom.Img: {"src", "alt", "title"},
+}
+
+var droppedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true, atom.Embed: true,
+	atom.Template: true, atom.Noscript: true, atom.Textarea: true, atom.Select: true, atom.Svg: true, atom.Math: true,
+}
+
+var voidTags = map[atom.Atom]bool{atom.Br: true, atom.Hr: true, atom.Img: true}
+
+// sanitizeHTML keeps the allowedTags of body and only safe link and image
+// URLs; anything it cannot parse is escaped as text.
+func sanitizeHTML(body string) string {
+	ctx := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(body), ctx)
+	if err != nil {
+		return renderPlain(body)
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		writeSanitized(&b, n)
+	}
+	return b.String()
+}
+
+func writeSanitized(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(html.EscapeString(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if droppedTags[n.DataAtom] {
+		return
+	}
+	attrs, ok := allowedTags[n.DataAtom]
+	if ok {
+		b.WriteString("<" + n.Data)
+		for _, a := range n.Attr {
+			if a.Namespace != "" || !slices.Contains(attrs, a.Key) {
+				continue
+			}
+			if (a.Key == "href" || a.Key == "src") && !safeURL(a.Val, a.Key == "src") {
+				continue
+			}
+			b.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+		}
+		if n.DataAtom == atom.A {
+			b.WriteString(` rel="nofollow noopener noreferrer"`)
+		}
+		b.WriteString(">")
+		if voidTags[n.DataAtom] {
+			return
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeSanitized(b, c)
+	}
+	if ok {
+		b.WriteString("</" + n.Data + ">")
+	}
+}
+
+// safeURL reports whether u may be linked to: http(s), mailto or a
+// relative reference. Images may also be data: images.
+func safeURL(u string, image bool) bool {
+	p, err := url.Parse(strings.TrimSpace(u))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(p.Scheme) {
+	case "", "http", "https":
+		return true
+	case "mailto":
+		return !image
+	case "data":
+		return image && strings.HasPrefix(strings.ToLower(p.Opaque), "image/") && !strings.HasPrefix(strings.ToLower(p.Opaque), "image/svg")
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// positionGap spaces default positions so a note can later be placed
+// between two neighbours without renumbering.
+const positionGap = 1024
+
+var errUnknownNotes = errors.New("some ids do not exist")
+
+type notePosition struct {
+	ID       int64 `json:"id"`
+	Position int64 `json:"position"`
+}
+
+// handleReorder serves PUT /api/notes/reorder with {"ids": [...]} listing
+// notes in their new relative order, typically one page of a sort=position
+// view. When a single note was moved, as by a drag, it alone is written: it
+// gets the midpoint between its new neighbours, and positions are only
+// renumbered once that gap runs out. Any other reorder swaps the notes
+// among the positions they already hold. Either way notes not listed keep
+// their place.
+func handleReorder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		IDs []noteKey `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		apiError(w, `body must be {"ids": [...]}`, http.StatusBadRequest)
+		return
+	}
+	ids, err := resolveNoteKeys(req.IDs)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if seen[id] && id != 0 {
+			apiError(w, "duplicate id in ids", http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+	}
+	defer observeQuery("update", time.Now())
+	var out []notePosition
+	err = withTx(func(tx *sql.Tx) error {
+		var err error
+		if out, err = reposition(tx, ids); err != nil {
+			return err
+		}
+		return requestActor(r).audit(tx, "update", ids...)
+	})
+	if errors.Is(err, errUnknownNotes) {
+		apiError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	notesChanged()
+	for _, p := range out {
+		publishState("moved", p.ID, map[string]any{"position": p.Position})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// reposition writes the new positions of ids. Rows are locked in id order
+// so concurrent reorders of overlapping pages serialize instead of
+// deadlocking.
+func reposition(tx *sql.Tx, ids []int64) ([]notePosition, error) {
+	pos, err := lockPositions(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+	cur := append([]int64(nil), ids...)
+	sort.Slice(cur, func(i, j int) bool {
+		if pos[cur[i]] != pos[cur[j]] {
+			return pos[cur[i]] < pos[cur[j]]
+		}
+		return cur[i] < cur[j]
+	})
+	if k, ok := singleMove(cur, ids); ok {
+		return moveBetween(tx, ids, pos, k)
+	}
+	slots := make([]int64, len(cur))
+	for i, id := range cur {
+		slots[i] = pos[id]
+	}
+	out := make([]notePosition, len(ids))
+	for i, id := range ids {
+		out[i] = notePosition{ID: id, Position: slots[i]}
+	}
+	_, err = tx.Exec(`
+		UPDATE `+notesTable+` n SET position = u.position, updated_at = $3
+		FROM unnest($1::bigint[], $2::bigint[]) AS u(id, position)
+		WHERE n.id = u.id AND n.position <> u.position
+	`, pq.Array(ids), pq.Array(slots), clock.Now())
+	return out, err
+}
+
+func lockPositions(tx *sql.Tx, ids []int64) (map[int64]int64, error) {
+	rows, err := tx.Query(
+		"SELECT id, position FROM "+notesTable+" WHERE id = ANY($1) AND deleted_at IS NULL ORDER BY id FOR UPDATE",
+		pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pos := map[int64]int64{}
+	for rows.Next() {
+		var id, p int64
+		if err := rows.Scan(&id, &p); err != nil {
+			return nil, err
+		}
+		pos[id] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(pos) != len(ids) {
+		return nil, errUnknownNotes
+	}
+	return pos, nil
+}
+
+// singleMove reports whether want is cur with one note moved, and if so
+// that note's index in want.
+func singleMove(cur, want []int64) (int, bool) {
+	i := 0
+	for i < len(cur) && cur[i] == want[i] {
+		i++
+	}
+	if i == len(cur) {
+		return 0, false
+	}
+	for _, m := range []int64{want[i], cur[i]} {
+		if slices.Equal(without(cur, m), without(want, m)) {
+			return slices.Index(want, m), true
+		}
+	}
+	return 0, false
+}
+
+func without(ids []int64, id int64) []int64 {
+	out := make([]int64, 0, len(ids))
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// moveBetween gives ids[k] the midpoint between its neighbours in ids. At
+// either end of the list the neighbour is the nearest note outside it, so
+// the note cannot jump past notes on the adjacent page.
+func moveBetween(tx *sql.Tx, ids []int64, pos map[int64]int64, k int) ([]notePosition, error) {
+	id := ids[k]
+	var lo, hi int64
+	for attempt := 0; ; attempt++ {
+		var err error
+		if lo, hi, err = neighbours(tx, ids, pos, k); err != nil {
+			return nil, err
+		}
+		if hi-lo >= 2 || attempt > 0 {
+			break
+		}
+		if err := renumberPositions(tx); err != nil {
+			return nil, err
+		}
+		if pos, err = lockPositions(tx, ids); err != nil {
+			return nil, err
+		}
+	}
+	p := lo + (hi-lo)/2
+	if _, err := tx.Exec("UPDATE "+notesTable+" SET position = $2, updated_at = $3 WHERE id = $1", id, p, clock.Now()); err != nil {
+		return nil, err
+	}
+	pos[id] = p
+	out := make([]notePosition, len(ids))
+	for i, id := range ids {
+		out[i] = notePosition{ID: id, Position: pos[id]}
+	}
+	return out, nil
+}
+
+func neighbours(tx *sql.Tx, ids []int64, pos map[int64]int64, k int) (lo, hi int64, err error) {
+	id := ids[k]
+	if k > 0 {
+		lo = pos[ids[k-1]]
+	} else {
+		next := pos[ids[k+1]]
+		var p sql.NullInt64
+		err = tx.QueryRow("SELECT MAX(position) FROM "+notesTable+" WHERE position < $1 AND id <> $2 AND deleted_at IS NULL", next, id).Scan(&p)
+		lo = next - 2*positionGap
+		if p.Valid {
+			lo = p.Int64
+		}
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if k < len(ids)-1 {
+		hi = pos[ids[k+1]]
+	} else {
+		prev := pos[ids[k-1]]
+		var p sql.NullInt64
+		err = tx.QueryRow("SELECT MIN(position) FROM "+notesTable+" WHERE position > $1 AND id <> $2 AND deleted_at IS NULL", prev, id).Scan(&p)
+		hi = prev + 2*positionGap
+		if p.Valid {
+			hi = p.Int64
+		}
+	}
+	return lo, hi, err
+}
+
+// renumberPositions spreads every note positionGap apart again, keeping
+// their order.
+func renumberPositions(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		UPDATE `+notesTable+` n SET position = r.rn * $1, updated_at = $2
+		FROM (SELECT id, row_number() OVER (ORDER BY position, id) AS rn FROM `+notesTable+`) r
+		WHERE n.id = r.id AND n.position <> r.rn * $1
+	`, positionGap, clock.Now())
+	return err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func positions(t *testing.T, notes []Note) map[int64]int64 {
+	t.Helper()
+	out := map[int64]int64{}
+	for _, n := range notes {
+		var p int64
+		if err := db.QueryRow("SELECT position FROM "+notesTable+" WHERE id = $1", n.ID).Scan(&p); err != nil {
+			t.Fatal(err)
+		}
+		out[n.ID] = p
+	}
+	return out
+}
+
+func TestReorderMiddleInsert(t *testing.T) {
+	testDB(t)
+	var notes []Note
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		notes = append(notes, createTestNote(t, Note{Title: title, Body: "x"}))
+	}
+	before := positions(t, notes)
+	a, b, c, d, e := notes[0], notes[1], notes[2], notes[3], notes[4]
+
+	// The page shows b, c, d; d is dragged between b and c.
+	rec := doJSON(t, handleReorder, http.MethodPut, "/api/notes/reorder", map[string]any{"ids": []int64{b.ID, d.ID, c.ID}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", rec.Code, rec.Body)
+	}
+	after := positions(t, notes)
+	for _, n := range []Note{a, b, c, e} {
+		if after[n.ID] != before[n.ID] {
+			t.Errorf("note %s moved from %d to %d", n.Title, before[n.ID], after[n.ID])
+		}
+	}
+	if !(after[b.ID] < after[d.ID] && after[d.ID] < after[c.ID]) {
+		t.Errorf("page order not b, d, c: %v", after)
+	}
+	if n := countNotes(t, "id <> $1 AND updated_at <> created_at", d.ID); n != 0 {
+		t.Errorf("%d notes written besides the moved one", n)
+	}
+}
+
+func TestReorderFromAnotherPage(t *testing.T) {
+	testDB(t)
+	var notes []Note
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		notes = append(notes, createTestNote(t, Note{Title: title, Body: "x"}))
+	}
+	before := positions(t, notes)
+	a, b, c, e := notes[0], notes[1], notes[2], notes[4]
+
+	// The page shows b, c; e is dragged in from a later page to its top.
+	rec := doJSON(t, handleReorder, http.MethodPut, "/api/notes/reorder", map[string]any{"ids": []int64{e.ID, b.ID, c.ID}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", rec.Code, rec.Body)
+	}
+	after := positions(t, notes)
+	if !(after[a.ID] < after[e.ID] && after[e.ID] < after[b.ID]) {
+		t.Errorf("e not placed between a and b: %v", after)
+	}
+	if after[c.ID] != before[c.ID] {
+		t.Errorf("c moved from %d to %d", before[c.ID], after[c.ID])
+	}
+}
+
+func TestReorderRenumbersWhenGapRunsOut(t *testing.T) {
+	testDB(t)
+	var notes []Note
+	for _, title := range []string{"a", "b", "c", "d"} {
+		notes = append(notes, createTestNote(t, Note{Title: title, Body: "x"}))
+	}
+	a, b, c, d := notes[0], notes[1], notes[2], notes[3]
+	for id, p := range map[int64]int64{a.ID: 10, b.ID: 11, c.ID: 12, d.ID: 13} {
+		if _, err := db.Exec("UPDATE "+notesTable+" SET position = $2 WHERE id = $1", id, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec := doJSON(t, handleReorder, http.MethodPut, "/api/notes/reorder", map[string]any{"ids": []int64{a.ID, d.ID, b.ID, c.ID}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", rec.Code, rec.Body)
+	}
+	after := positions(t, notes)
+	if !(after[a.ID] < after[d.ID] && after[d.ID] < after[b.ID] && after[b.ID] < after[c.ID]) {
+		t.Errorf("order not a, d, b, c: %v", after)
+	}
+}
+
+func TestReorderConcurrent(t *testing.T) {
+	testDB(t)
+	var notes []Note
+	for i := 0; i < 6; i++ {
+		notes = append(notes, createTestNote(t, Note{Title: "n", Body: "x"}))
+	}
+	pages := [][]int64{
+		{notes[0].ID, notes[1].ID, notes[2].ID, notes[3].ID},
+		{notes[2].ID, notes[3].ID, notes[4].ID, notes[5].ID},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids := append([]int64(nil), pages[i%2]...)
+			rand.New(rand.NewSource(int64(i))).Shuffle(len(ids), func(a, b int) { ids[a], ids[b] = ids[b], ids[a] })
+			rec := doJSON(t, handleReorder, http.MethodPut, "/api/notes/reorder", map[string]any{"ids": ids})
+			if rec.Code != http.StatusOK {
+				t.Errorf("reorder %v: status %d; body %s", ids, rec.Code, rec.Body)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// However the reorders interleaved, no two notes share a position.
+	after := positions(t, notes)
+	seen := map[int64]bool{}
+	for _, n := range notes {
+		if seen[after[n.ID]] {
+			t.Fatalf("positions %v after concurrent reorders share a slot", after)
+		}
+		seen[after[n.ID]] = true
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Revision is an earlier title and body of a note, as it was until
+// created_at, when it was replaced.
+type Revision struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// revisionMatch tells a search with include_revisions=true which earlier
+// version of a note matched.
+type revisionMatch struct {
+	RevisionID int64     `json:"revision_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Snippet    string    `json:"snippet"`
+}
+
+// saveRevision keeps the current title and body of the note matching cond
+// (a condition on $1) before an update replaces them with title and body.
+// Nothing is saved when they do not change.
+func saveRevision(tx *sql.Tx, cond string, key any, title, body string) error {
+	_, err := tx.Exec(`
+		INSERT INTO note_revisions (note_id, title, body, created_at)
+		SELECT id, title, body, $4 FROM `+notesTable+`
+		WHERE `+cond+` AND (title, body) IS DISTINCT FROM ($2, $3)
+	`, key, title, body, clock.Now())
+	return err
+}
+
+// revisionCond is the search condition on note_revisions rv for scope,
+// with q bound to placeholder qarg.
+func revisionCond(scope, qarg string) string {
+	switch scope {
+	case "title":
+		return "rv.title ILIKE " + qarg
+	case "body":
+		return "to_tsvector('english', rv.body) @@ plainto_tsquery('english', " + qarg + ")"
+	default:
+		return "to_tsvector('english', rv.title || ' ' || rv.body) @@ plainto_tsquery('english', " + qarg + ")"
+	}
+}
+
+// revisionQuery is the argument revisionCond's placeholder expects.
+func revisionQuery(scope, q string) string {
+	if scope == "title" {
+		return "%" + escapeLike(q) + "%"
+	}
+	return q
+}
+
+// addRevisionMatches sets RevisionMatch on notes with a revision matching
+// q, using the most recent such revision.
+func addRevisionMatches(notes []Note, scope, q string) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(notes))
+	for i, n := range notes {
+		ids[i] = n.ID
+	}
+	snippet := "ts_headline('english', rv.body, plainto_tsquery('english', $2))"
+	if scope == "title" {
+		snippet = "rv.title"
+	}
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (rv.note_id) rv.note_id, rv.id, rv.created_at, `+snippet+`
+		FROM note_revisions rv WHERE rv.note_id = ANY($1) AND `+revisionCond(scope, "$2")+`
+		ORDER BY rv.note_id, rv.created_at DESC, rv.id DESC
+	`, pq.Array(ids), revisionQuery(scope, q))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	matches := map[int64]*revisionMatch{}
+	for rows.Next() {
+		var id int64
+		var m revisionMatch
+		if err := rows.Scan(&id, &m.RevisionID, &m.CreatedAt, &m.Snippet); err != nil {
+			return err
+		}
+		matches[id] = &m
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range notes {
+		notes[i].RevisionMatch = matches[notes[i].ID]
+	}
+	return nil
+}
+
+// includeRevisions reports whether a search should also match earlier
+// versions of notes.
+func includeRevisions(r *http.Request) bool {
+	return r.URL.Query().Get("include_revisions") == "true" && strings.TrimSpace(r.URL.Query().Get("q")) != ""
+}
+
+// listRevisions serves GET /api/notes/{id}/revisions, newest first.
+func listRevisions(w http.ResponseWriter, id int64) {
+	defer observeQuery("get", time.Now())
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM "+notesTable+" WHERE id = $1 AND deleted_at IS NULL)", id).Scan(&exists); err != nil {
+		serverError(w, err)
+		return
+	}
+	if !exists {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	revs := []Revision{}
+	err := retry(func() error {
+		revs = revs[:0]
+		rows, err := db.Query(`
+			SELECT id, title, body, created_at FROM note_revisions
+			WHERE note_id = $1 ORDER BY created_at DESC, id DESC
+		`, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var rv Revision
+			if err := rows.Scan(&rv.ID, &rv.Title, &rv.Body, &rv.CreatedAt); err != nil {
+				return err
+			}
+			revs = append(revs, rv)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, revs)
+}
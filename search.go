@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// searchCache holds search responses (list requests with q) separately from
+// listCache so repeated queries can be kept longer; nil when
+// SEARCH_CACHE=false.
+var searchCache *responseCache
+
+// searchKey normalizes a search request's query string so that queries
+// differing only in case or spacing share a cache entry. Both search modes
+// are case-insensitive, so this does not change results.
+func searchKey(r *http.Request) string {
+	qs := r.URL.Query()
+	qs.Set("q", strings.Join(strings.Fields(strings.ToLower(qs.Get("q"))), " "))
+	return qs.Encode()
+}
+
+// searchLimiter rate limits searches per client IP with a token bucket:
+// SEARCH_RATE_LIMIT searches a minute, bursting to SEARCH_RATE_BURST.
+// A zero rate disables it.
+type searchLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+
+	limited atomic.Int64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxBuckets bounds the limiter's memory; full buckets are dropped first.
+const maxBuckets = 10000
+
+var searchLimit = &searchLimiter{buckets: map[string]*tokenBucket{}}
+
+func (l *searchLimiter) configure(perMinute, burst int) {
+	l.rate = float64(perMinute) / 60
+	l.burst = float64(max(burst, 1))
+}
+
+// allow takes a token for key, or reports how long until one is available.
+func (l *searchLimiter) allow(key string) (bool, time.Duration) {
+	if l.rate <= 0 {
+		return true, 0
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.buckets[key]
+	if b == nil {
+		if len(l.buckets) >= maxBuckets {
+			l.prune(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		l.limited.Add(1)
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune drops buckets that have refilled, since they behave like new ones.
+func (l *searchLimiter) prune(now time.Time) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// limitSearch enforces searchLimit for r, writing a 429 when it is over.
+func limitSearch(w http.ResponseWriter, r *http.Request) bool {
+	ok, wait := searchLimit.allow(clientIP(r))
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+		apiError(w, "too many searches", http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+// fullTextSearch is false when the search_vector column could not be
+// created, e.g. on a PostgreSQL without generated columns. Searches then
+// fall back to ILIKE over title and body, which is slower but works.
+var fullTextSearch = true
+
+// initSearch adds the full-text search column and index, built with each
+// note's language. Unlike other migrations, failing here is not fatal: it
+// leaves search degraded.
+func initSearch() {
+	loadSearchLanguages()
+	// to_tsvector(text::regconfig, ...) is not immutable, as the cast looks
+	// the configuration up, so a generated column cannot use it directly.
+	fn := notesTable + "_tsvector"
+	steps := []string{
+		`CREATE OR REPLACE FUNCTION ` + fn + `(lang TEXT, doc TEXT) RETURNS tsvector
+			LANGUAGE sql IMMUTABLE AS $$ SELECT to_tsvector(lang::regconfig, doc) $$`,
+	}
+	// Columns from before notes had a language were always English.
+	var expr string
+	err := db.QueryRow(`
+		SELECT COALESCE(generation_expression, '') FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 AND column_name = 'search_vector'
+	`, notesTable).Scan(&expr)
+	if err == nil && !strings.Contains(expr, fn) {
+		steps = append(steps, `ALTER TABLE `+notesTable+` DROP COLUMN search_vector`)
+	}
+	steps = append(steps,
+		`ALTER TABLE `+notesTable+` ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (`+fn+`(language, title || ' ' || body)) STORED`,
+		`CREATE INDEX IF NOT EXISTS `+notesTable+`_search_idx ON `+notesTable+` USING GIN (search_vector)`,
+	)
+	// One transaction, so that a failure keeps the old column.
+	err = withTx(func(tx *sql.Tx) error {
+		for _, m := range steps {
+			if _, err := tx.Exec(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("warning: init search: %v", err)
+	}
+	var ok bool
+	err = db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 AND column_name = 'search_vector')
+	`, notesTable).Scan(&ok)
+	if err != nil {
+		log.Fatal("init db:", err)
+	}
+	if !ok {
+		fullTextSearch = false
+		log.Printf("warning: %s.search_vector is missing; search falls back to ILIKE", notesTable)
+	}
+}
+
+// tsQuery builds the text search query for q in config. With prefix, the
+// last word also matches longer words it begins, so that results grow as
+// the user types. Only letters and digits reach to_tsquery, so q cannot
+// inject query operators.
+func tsQuery(c *whereClause, config, q string, prefix bool) string {
+	cfg := c.arg(config) + "::regconfig"
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if !prefix || len(words) == 0 {
+		return "plainto_tsquery(" + cfg + ", " + c.arg(q) + ")"
+	}
+	last := "to_tsquery(" + cfg + ", " + c.arg(words[len(words)-1]+":*") + ")"
+	if len(words) == 1 {
+		return last
+	}
+	return "(plainto_tsquery(" + cfg + ", " + c.arg(strings.Join(words[:len(words)-1], " ")) + ") && " + last + ")"
+}
+
+// loadSearchLanguages fills searchLanguages from pg_ts_config.
+func loadSearchLanguages() {
+	rows, err := db.Query("SELECT cfgname FROM pg_ts_config")
+	if err != nil {
+		log.Printf("warning: list text search configurations: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Printf("warning: list text search configurations: %v", err)
+			return
+		}
+		searchLanguages[name] = true
+	}
+	if !searchLanguages[defaultLanguage] {
+		log.Fatalf("DEFAULT_LANGUAGE %q is not a text search configuration", defaultLanguage)
+	}
+}
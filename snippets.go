@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// snippetRe matches a {{name}} placeholder. Names are fixed words looked up
+// in expandSnippets; nothing in a body is ever evaluated.
+var snippetRe = regexp.MustCompile(`\{\{\s*([a-z]+(?:\.[a-z]+)?)\s*\}\}`)
+
+var quotes = []string{
+	"Simplicity is prerequisite for reliability. — Edsger W. Dijkstra",
+	"The palest ink is better than the best memory. — Chinese proverb",
+	"What gets written down gets done.",
+	"Make it work, make it right, make it fast. — Kent Beck",
+	"Writing is nature's way of letting you know how sloppy your thinking is. — Dick Guindon",
+}
+
+// expandSnippets replaces the placeholders in n's body with their current
+// values, as of now in loc: {{today}}, {{now}}, {{note.title}},
+// {{note.created}}, {{note.count}} and {{random.quote}}. Unknown
+// placeholders are left as they are.
+func expandSnippets(n *Note, now time.Time, loc *time.Location) error {
+	var count string
+	var err error
+	n.Body = snippetRe.ReplaceAllStringFunc(n.Body, func(m string) string {
+		switch snippetRe.FindStringSubmatch(m)[1] {
+		case "today":
+			return now.In(loc).Format("2006-01-02")
+		case "now":
+			return now.In(loc).Format(time.RFC3339)
+		case "note.title":
+			return n.Title
+		case "note.created":
+			return n.CreatedAt.In(loc).Format("2006-01-02")
+		case "note.count":
+			if count == "" && err == nil {
+				var c int64
+				c, err = unfilteredCount()
+				count = strconv.FormatInt(c, 10)
+			}
+			return count
+		case "random.quote":
+			return quotes[rand.Intn(len(quotes))]
+		}
+		return m
+	})
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// snoozeNote hides a note from lists until {"until": RFC 3339 time} or for
+// {"for": duration}, e.g. "3d". Lists show it again once the time passes;
+// include_snoozed=true shows it throughout.
+func snoozeNote(w http.ResponseWriter, r *http.Request, id int64) {
+	var req struct {
+		Until *time.Time `json:"until"`
+		For   string     `json:"for"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := clock.Now()
+	var until time.Time
+	switch {
+	case req.Until != nil && req.For != "":
+		writeValidationErrors(w, validationErrors{"for": "give either until or for, not both"})
+		return
+	case req.Until != nil:
+		until = *req.Until
+	case req.For != "":
+		d, err := parseAge(req.For)
+		if err != nil {
+			writeValidationErrors(w, validationErrors{"for": err.Error()})
+			return
+		}
+		until = now.Add(d)
+	default:
+		writeValidationErrors(w, validationErrors{"until": "required"})
+		return
+	}
+	if !until.After(now) {
+		writeValidationErrors(w, validationErrors{"until": "must be in the future"})
+		return
+	}
+	setSnoozed(w, r, id, &until)
+}
+
+func unsnoozeNote(w http.ResponseWriter, r *http.Request, id int64) {
+	setSnoozed(w, r, id, nil)
+}
+
+func setSnoozed(w http.ResponseWriter, r *http.Request, id int64, until *time.Time) {
+	defer observeQuery("update", time.Now())
+	var n Note
+	err := withTx(func(tx *sql.Tx) error {
+		var err error
+		n, err = scanNote(tx.QueryRow(
+			"UPDATE "+notesTable+" SET snoozed_until = $2, updated_at = $3 WHERE id = $1 AND deleted_at IS NULL RETURNING "+noteColumns,
+			id, until, clock.Now(),
+		))
+		if err != nil {
+			return err
+		}
+		return requestActor(r).audit(tx, "update", n.ID)
+	})
+	switch {
+	case err == sql.ErrNoRows:
+		apiError(w, "not found", http.StatusNotFound)
+	case err != nil:
+		serverError(w, err)
+	default:
+		notesChanged()
+		typ := "unsnoozed"
+		if until != nil {
+			typ = "snoozed"
+		}
+		publishState(typ, n.ID, map[string]any{"snoozed_until": n.SnoozedUntil})
+		writeNoteJSON(w, r, http.StatusOK, n)
+	}
+}
+
+// awake is the condition hiding notes snoozed until later.
+func awake(c *whereClause) string {
+	return "(snoozed_until IS NULL OR snoozed_until <= " + c.arg(clock.Now()) + ")"
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Standard Notes backups are one JSON document of items: notes, and tags
+// that list the notes they apply to as references. Only decrypted backups
+// can be read.
+
+type snBackup struct {
+	Version string   `json:"version"`
+	Items   []snItem `json:"items"`
+}
+
+type snItem struct {
+	UUID        string          `json:"uuid"`
+	ContentType string          `json:"content_type"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Content     json.RawMessage `json:"content"`
+}
+
+type snContent struct {
+	Title      string        `json:"title"`
+	Text       string        `json:"text,omitempty"`
+	Pinned     bool          `json:"pinned,omitempty"`
+	Trashed    bool          `json:"trashed,omitempty"`
+	References []snReference `json:"references"`
+}
+
+type snReference struct {
+	UUID        string `json:"uuid"`
+	ContentType string `json:"content_type"`
+}
+
+// snExternalPrefix marks the external_id of notes imported from Standard
+// Notes, so importing the same backup again updates them in place.
+const snExternalPrefix = "standardnotes:"
+
+// snTagUUID derives a stable UUID for a tag name, so repeated exports name
+// each tag the same way.
+func snTagUUID(tag string) string {
+	h := sha1.Sum([]byte("simplenote-tag:" + tag))
+	h[6] = h[6]&0x0f | 0x50
+	h[8] = h[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// handleExportStandardNotes serves GET /api/notes/export.standardnotes as
+// a decrypted Standard Notes backup of the notes matching the list filters.
+func handleExportStandardNotes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	where, err := exportFilters(r)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer observeQuery("export", time.Now())
+	notes, err := queryNotesContext(r.Context(), "SELECT "+noteColumns+" FROM "+notesTable+where.String()+" ORDER BY id", where.args...)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	backup := snBackup{Version: "004", Items: []snItem{}}
+	tagged := map[string][]snReference{}
+	firstUse := map[string]time.Time{}
+	for _, n := range notes {
+		content, _ := json.Marshal(snContent{Title: n.Title, Text: n.Body, Pinned: n.Pinned, References: []snReference{}})
+		backup.Items = append(backup.Items, snItem{
+			UUID: n.UUID, ContentType: "Note", CreatedAt: n.CreatedAt, UpdatedAt: n.UpdatedAt, Content: content,
+		})
+		for _, t := range n.Tags {
+			tagged[t] = append(tagged[t], snReference{UUID: n.UUID, ContentType: "Note"})
+			if first, ok := firstUse[t]; !ok || n.CreatedAt.Before(first) {
+				firstUse[t] = n.CreatedAt
+			}
+		}
+	}
+	tags := make([]string, 0, len(tagged))
+	for t := range tagged {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	for _, t := range tags {
+		content, _ := json.Marshal(snContent{Title: t, References: tagged[t]})
+		backup.Items = append(backup.Items, snItem{
+			UUID: snTagUUID(t), ContentType: "Tag", CreatedAt: firstUse[t], UpdatedAt: firstUse[t], Content: content,
+		})
+	}
+	name := "notes-" + clock.Now().UTC().Format("20060102") + ".standardnotes.json"
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	writeJSON(w, http.StatusOK, backup)
+}
+
+// handleImportStandardNotes serves POST /api/notes/import.standardnotes,
+// reading a decrypted Standard Notes backup. Notes keep their title, text,
+// pin and tags, and with keep_created_at=true (admin only) their
+// timestamps; trashed notes and other item types are skipped. Each note is
+// stored with external_id "standardnotes:<uuid>", so a second import of
+// the same backup updates the notes it made.
+func handleImportStandardNotes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !decodeBody(w, r) {
+		return
+	}
+	keepTimes, ok := keepTimestamps(w, r)
+	if !ok {
+		return
+	}
+	r.Body = io.NopCloser(io.LimitReader(r.Body, maxImportLine))
+	if err := checkUTF8Body(r); err != nil {
+		apiError(w, "invalid Standard Notes backup: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var backup snBackup
+	if err := json.NewDecoder(r.Body).Decode(&backup); err != nil {
+		apiError(w, "invalid Standard Notes backup: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	contents := make([]snContent, len(backup.Items))
+	tags := map[string][]string{}
+	for i, it := range backup.Items {
+		if c := bytes.TrimSpace(it.Content); len(c) > 0 && c[0] == '"' {
+			apiError(w, "encrypted Standard Notes backups are not supported: export a decrypted backup", http.StatusBadRequest)
+			return
+		}
+		if err := json.Unmarshal(it.Content, &contents[i]); err != nil && len(it.Content) > 0 {
+			apiError(w, fmt.Sprintf("invalid content of item %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+		if it.ContentType == "Tag" {
+			for _, ref := range contents[i].References {
+				if ref.ContentType == "Note" {
+					tags[ref.UUID] = append(tags[ref.UUID], contents[i].Title)
+				}
+			}
+		}
+	}
+	size := queryInt(r, "batch_size", importBatchSize, 1, 10000)
+	var p importProgress
+	var res csvImportResult
+	fail := func(item int, err error) {
+		res.Skipped++
+		if len(res.Errors) < maxImportErrors {
+			res.Errors = append(res.Errors, importError{Line: item, Error: err.Error()})
+		}
+	}
+	batch := make([]importItem, 0, size)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := importBatch(requestActor(r), batch, &p, fail, false)
+		batch = batch[:0]
+		if err == nil {
+			notesChanged()
+		}
+		return err
+	}
+	for i, it := range backup.Items {
+		if it.ContentType != "Note" || contents[i].Trashed {
+			continue
+		}
+		ext := snExternalPrefix + it.UUID
+		n := Note{
+			Title: contents[i].Title, Body: contents[i].Text, Tags: tags[it.UUID],
+			Pinned: contents[i].Pinned, ExternalID: &ext,
+		}
+		item := importItem{line: i + 1, note: n}
+		if keepTimes && !it.CreatedAt.IsZero() {
+			var err error
+			if item.created, item.updated, err = importTimes(it.CreatedAt, it.UpdatedAt); err != nil {
+				fail(i+1, err)
+				continue
+			}
+		}
+		var err error
+		if item.atts, err = prepareNote(&item.note); err != nil {
+			fail(i+1, err)
+			continue
+		}
+		batch = append(batch, item)
+		if len(batch) == size {
+			if err := flush(); err != nil {
+				res.Error = err.Error()
+				break
+			}
+		}
+	}
+	if res.Error == "" {
+		if err := flush(); err != nil {
+			res.Error = err.Error()
+		}
+	}
+	res.Imported = p.Imported
+	analyzeNotes("import", p.Imported)
+	status := http.StatusOK
+	if res.Error != "" {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, res)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// staticMaxAge is the Cache-Control max-age for /static/ files
+// (STATIC_MAX_AGE). Files are revalidated by ETag once it runs out.
+var staticMaxAge = time.Hour
+
+type staticFile struct {
+	data []byte
+	etag string
+}
+
+// staticFiles holds the embedded assets by URL path, hashed once at
+// startup. HTML files are templates rendered by their own handlers and are
+// not served raw.
+var staticFiles map[string]staticFile
+
+func loadStaticFiles() map[string]staticFile {
+	files := map[string]staticFile{}
+	fs.WalkDir(staticFS, "static", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) == ".html" {
+			return err
+		}
+		data, err := staticFS.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		files["/"+p] = staticFile{data: data, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+		return nil
+	})
+	return files
+}
+
+// handleStatic serves /static/ from the embedded FS. http.ServeContent
+// answers If-None-Match with 304 given the ETag.
+func handleStatic(w http.ResponseWriter, r *http.Request) {
+	f, ok := staticFiles[r.URL.Path]
+	if !ok || strings.Contains(r.URL.Path, "..") {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", f.etag)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(staticMaxAge/time.Second)))
+	http.ServeContent(w, r, path.Base(r.URL.Path), time.Time{}, bytes.NewReader(f.data))
+}
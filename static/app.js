@@ -0,0 +1,77 @@
+const form = document.getElementById('form');
+const titleIn = document.getElementById('title');
+const bodyIn = document.getElementById('body');
+const cancelBtn = document.getElementById('cancelBtn');
+const viewBtn = document.getElementById('viewBtn');
+const notesList = document.getElementById('notesList');
+const notesContainer = document.getElementById('notes');
+const errEl = document.getElementById('error');
+const csrfMeta = document.querySelector('meta[name="csrf-token"]');
+
+function showErr(msg) {
+  errEl.textContent = msg || '';
+  errEl.classList.toggle('hidden', !msg);
+}
+
+form.addEventListener('submit', async (e) => {
+  e.preventDefault();
+  showErr('');
+  const title = titleIn.value.trim();
+  const body = bodyIn.value.trim();
+  if (!title && !body) {
+    showErr('Введите заголовок или текст.');
+    return;
+  }
+  try {
+    const res = await fetch('/api/notes', {
+      method: 'POST',
+      headers: Object.assign({ 'Content-Type': 'application/json' },
+        csrfMeta ? { 'X-CSRF-Token': csrfMeta.content } : {}),
+      body: JSON.stringify({ title, body })
+    });
+    if (!res.ok) {
+      const text = await res.text();
+      let msg = text;
+      try { msg = JSON.parse(text).error || text; } catch (e) {}
+      throw new Error(msg);
+    }
+    const data = await res.json();
+    titleIn.value = '';
+    bodyIn.value = '';
+    showErr('');
+    if (notesList.classList.contains('hidden') === false) loadNotes();
+  } catch (err) {
+    showErr(err.message || 'Ошибка сохранения');
+  }
+});
+
+cancelBtn.addEventListener('click', () => {
+  titleIn.value = '';
+  bodyIn.value = '';
+  showErr('');
+});
+
+async function loadNotes() {
+  const res = await fetch('/api/notes');
+  if (!res.ok) { notesContainer.innerHTML = '<p class="error">Не удалось загрузить заметки</p>'; return; }
+  const notes = await res.json();
+  notesList.classList.remove('hidden');
+  if (notes.length === 0) {
+    notesContainer.innerHTML = '<p>Нет заметок.</p>';
+    return;
+  }
+  notesContainer.innerHTML = notes.map(n => {
+    const d = new Date(n.created_at).toLocaleString('ru');
+    return `<div class="note"><div class="meta">#${n.id} · ${d}</div><h3>${escapeHtml(n.title || '(без заголовка)')}</h3><div class="body">${escapeHtml(n.body)}</div></div>`;
+  }).join('');
+}
+
+function escapeHtml(s) {
+  const div = document.createElement('div');
+  div.textContent = s;
+  return div.innerHTML;
+}
+
+viewBtn.addEventListener('click', () => {
+  loadNotes();
+});
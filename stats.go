@@ -0,0 +1,171 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// statsTable holds one row of running totals over notesTable, kept up to
+// date by a trigger so that stats and unfiltered counts do not scan the
+// table. reconcileStats rebuilds it should it ever drift.
+func statsTable() string { return notesTable + "_stats" }
+
+// statsMigrations creates the totals table, seeded from the notes already
+// there, and the trigger maintaining it.
+func statsMigrations() []string {
+	t := statsTable()
+	return []string{
+		`CREATE TABLE IF NOT EXISTS ` + t + ` (
+			id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+			live BIGINT NOT NULL DEFAULT 0,
+			trashed BIGINT NOT NULL DEFAULT 0,
+			pinned BIGINT NOT NULL DEFAULT 0,
+			public BIGINT NOT NULL DEFAULT 0,
+			body_chars BIGINT NOT NULL DEFAULT 0
+		)`,
+		`CREATE OR REPLACE FUNCTION ` + t + `_fn() RETURNS trigger AS $$
+		DECLARE
+			d_live BIGINT := 0; d_trashed BIGINT := 0; d_pinned BIGINT := 0;
+			d_public BIGINT := 0; d_chars BIGINT := 0;
+		BEGIN
+			IF TG_OP IN ('UPDATE', 'DELETE') THEN
+				IF OLD.deleted_at IS NULL THEN
+					d_live := d_live - 1;
+					d_pinned := d_pinned - OLD.pinned::int;
+					d_public := d_public - OLD.public::int;
+					d_chars := d_chars - char_length(OLD.body);
+				ELSE
+					d_trashed := d_trashed - 1;
+				END IF;
+			END IF;
+			IF TG_OP IN ('UPDATE', 'INSERT') THEN
+				IF NEW.deleted_at IS NULL THEN
+					d_live := d_live + 1;
+					d_pinned := d_pinned + NEW.pinned::int;
+					d_public := d_public + NEW.public::int;
+					d_chars := d_chars + char_length(NEW.body);
+				ELSE
+					d_trashed := d_trashed + 1;
+				END IF;
+			END IF;
+			IF d_live <> 0 OR d_trashed <> 0 OR d_pinned <> 0 OR d_public <> 0 OR d_chars <> 0 THEN
+				UPDATE ` + t + ` SET live = live + d_live, trashed = trashed + d_trashed,
+					pinned = pinned + d_pinned, public = public + d_public, body_chars = body_chars + d_chars;
+			END IF;
+			RETURN NULL;
+		END
+		$$ LANGUAGE plpgsql`,
+		`INSERT INTO ` + t + ` (id, live, trashed, pinned, public, body_chars)
+			SELECT true, a.* FROM (` + statsAggregate() + `) a ON CONFLICT DO NOTHING`,
+		`DO $$ BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = '` + t + `_trg') THEN
+				CREATE TRIGGER ` + t + `_trg AFTER INSERT OR UPDATE OR DELETE ON ` + notesTable + `
+					FOR EACH ROW EXECUTE PROCEDURE ` + t + `_fn();
+			END IF;
+		END $$`,
+		`CREATE INDEX IF NOT EXISTS ` + notesTable + `_publish_at_idx ON ` + notesTable + ` (publish_at) WHERE publish_at IS NOT NULL`,
+	}
+}
+
+// statsAggregate computes the totals from scratch.
+func statsAggregate() string {
+	return `SELECT
+		COUNT(*) FILTER (WHERE deleted_at IS NULL) AS live,
+		COUNT(*) FILTER (WHERE deleted_at IS NOT NULL) AS trashed,
+		COUNT(*) FILTER (WHERE deleted_at IS NULL AND pinned) AS pinned,
+		COUNT(*) FILTER (WHERE deleted_at IS NULL AND public) AS public,
+		COALESCE(SUM(char_length(body)) FILTER (WHERE deleted_at IS NULL), 0) AS body_chars
+		FROM ` + notesTable
+}
+
+// reconcileStats recomputes the totals from notesTable. The table is
+// locked against writes meanwhile so the rebuilt row is exact.
+func reconcileStats() error {
+	tx, err := beginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("LOCK TABLE " + notesTable + " IN SHARE MODE"); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE ` + statsTable() + ` s SET live = a.live, trashed = a.trashed, pinned = a.pinned,
+			public = a.public, body_chars = a.body_chars
+		FROM (` + statsAggregate() + `) a`)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type noteStats struct {
+	Notes         int64   `json:"notes"`
+	Trashed       int64   `json:"trashed"`
+	Pinned        int64   `json:"pinned"`
+	Public        int64   `json:"public"`
+	AvgBodyLength float64 `json:"avg_body_length"`
+}
+
+func loadStats() (noteStats, error) {
+	var s noteStats
+	var chars int64
+	err := retry(func() error {
+		return db.QueryRow("SELECT live, trashed, pinned, public, body_chars FROM "+statsTable()).
+			Scan(&s.Notes, &s.Trashed, &s.Pinned, &s.Public, &chars)
+	})
+	if s.Notes > 0 {
+		s.AvgBodyLength = float64(chars) / float64(s.Notes)
+	}
+	return s, err
+}
+
+// handleStats serves GET /api/stats from the precomputed totals. Notes
+// scheduled for later count as notes here.
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer observeQuery("count", time.Now())
+	s, err := loadStats()
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// handleReconcileStats serves POST /admin/reconcile-stats.
+func handleReconcileStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer observeQuery("count", time.Now())
+	if err := reconcileStats(); err != nil {
+		serverError(w, err)
+		return
+	}
+	s, err := loadStats()
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// unfilteredCount answers /api/notes/count without parameters from the
+// totals, less the notes scheduled for later or snoozed, which the partial
+// publish_at and snoozed_until indexes find cheaply.
+func unfilteredCount() (int64, error) {
+	var count int64
+	err := retry(func() error {
+		return db.QueryRow(`
+			SELECT (SELECT live FROM `+statsTable()+`) -
+				(SELECT COUNT(*) FROM `+notesTable+` WHERE deleted_at IS NULL AND
+					((publish_at IS NOT NULL AND publish_at > $1) OR (snoozed_until IS NOT NULL AND snoozed_until > $1)))
+		`, clock.Now()).Scan(&count)
+	})
+	return count, err
+}
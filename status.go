@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type noteStatus struct {
+	ID        noteKey    `json:"id"`
+	Exists    bool       `json:"exists"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// handleNoteStatus serves POST /api/notes/status with {"ids": [...]},
+// answering for each id, in order and as it was given, whether the note
+// exists (trashed notes do not) and when it last changed, so clients can
+// reconcile caches without fetching bodies.
+func handleNoteStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		IDs []noteKey `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > maxBatchIDs {
+		apiError(w, fmt.Sprintf("too many ids (max %d)", maxBatchIDs), http.StatusBadRequest)
+		return
+	}
+	defer observeQuery("get", time.Now())
+	ids, err := resolveNoteKeys(req.IDs)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	var out []noteStatus
+	err = retry(func() error {
+		out = make([]noteStatus, 0, len(req.IDs))
+		rows, err := db.Query(`
+			SELECT u.ord, n.updated_at
+			FROM unnest($1::bigint[]) WITH ORDINALITY AS u(id, ord)
+			LEFT JOIN `+notesTable+` n ON n.id = u.id AND n.deleted_at IS NULL
+			ORDER BY u.ord`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var s noteStatus
+			var ord int
+			if err := rows.Scan(&ord, &s.UpdatedAt); err != nil {
+				return err
+			}
+			s.ID = req.IDs[ord-1]
+			s.Exists = s.UpdatedAt != nil
+			out = append(out, s)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
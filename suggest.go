@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxSuggestLimit = 50
+
+// defaultSuggestLimit is how many matches /api/notes/suggest returns
+// without a limit parameter.
+var defaultSuggestLimit = 10
+
+// trigramSuggest is true when pg_trgm is available; suggestions then also
+// match titles that are merely similar to the query.
+var trigramSuggest = true
+
+// initSuggest sets up the title indexes behind /api/notes/suggest. Like
+// initSearch it is not fatal: without pg_trgm, suggestions only match
+// prefixes and substrings.
+func initSuggest() {
+	for _, m := range []string{
+		`CREATE INDEX IF NOT EXISTS ` + notesTable + `_title_prefix_idx ON ` + notesTable + ` (lower(title) text_pattern_ops) WHERE deleted_at IS NULL`,
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`CREATE INDEX IF NOT EXISTS ` + notesTable + `_title_trgm_idx ON ` + notesTable + ` USING GIN (title gin_trgm_ops) WHERE deleted_at IS NULL`,
+	} {
+		if _, err := db.Exec(m); err != nil {
+			log.Printf("warning: init suggest: %v", err)
+		}
+	}
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')`).Scan(&trigramSuggest)
+	if err != nil {
+		log.Fatal("init db:", err)
+	}
+	if !trigramSuggest {
+		log.Printf("warning: pg_trgm is not installed; suggestions match substrings only")
+	}
+}
+
+type suggestion struct {
+	ID    int64  `json:"id"`
+	UUID  string `json:"uuid"`
+	Title string `json:"title"`
+}
+
+// handleSuggest serves GET /api/notes/suggest?q=<prefix>[&limit=n]: titles
+// for a quick switcher, prefix matches first, then the most similar.
+func handleSuggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeJSON(w, http.StatusOK, []suggestion{})
+		return
+	}
+	limit := defaultSuggestLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSuggestLimit {
+			apiError(w, "limit must be between 1 and "+strconv.Itoa(maxSuggestLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	where := &whereClause{}
+	where.add("deleted_at IS NULL")
+	where.add(published(where))
+	prefix := where.arg(escapeLike(strings.ToLower(q)) + "%")
+	order := "lower(title) LIKE " + prefix + " DESC"
+	if trigramSuggest {
+		qa := where.arg(q)
+		where.add("(lower(title) LIKE " + prefix + " OR title % " + qa + ")")
+		order += ", similarity(title, " + qa + ") DESC"
+	} else {
+		where.add("title ILIKE " + where.arg("%"+escapeLike(q)+"%"))
+	}
+	query := "SELECT id, uuid, title FROM " + notesTable + where.String() +
+		" ORDER BY " + order + ", title, id LIMIT " + where.arg(limit)
+	defer observeQuery("suggest", time.Now())
+	out := []suggestion{}
+	err := retry(func() error {
+		out = out[:0]
+		rows, err := db.Query(query, where.args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var s suggestion
+			if err := rows.Scan(&s.ID, &s.UUID, &s.Title); err != nil {
+				return err
+			}
+			out = append(out, s)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
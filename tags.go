@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+type bulkTagRequest struct {
+	Keys   []noteKey `json:"ids"`
+	Add    []string  `json:"add"`
+	Remove []string  `json:"remove"`
+
+	// IDs are Keys resolved to integer ids.
+	IDs []int64 `json:"-"`
+}
+
+// handleBulkTag adds and removes tags across many notes in one transaction.
+// Tags already present are not appended twice.
+func handleBulkTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req bulkTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Keys) == 0 {
+		apiError(w, "ids required", http.StatusBadRequest)
+		return
+	}
+	for _, t := range uniqueTags(req.Add) {
+		if utf8.RuneCountInString(t) > maxTagLength {
+			writeValidationErrors(w, validationErrors{"add": validateTags([]string{t})})
+			return
+		}
+	}
+	defer observeQuery("update", time.Now())
+	var err error
+	if req.IDs, err = resolveNoteKeys(req.Keys); err != nil {
+		serverError(w, err)
+		return
+	}
+	updated := map[int64]bool{}
+	err = withTx(func(tx *sql.Tx) error {
+		if len(req.Add) > 0 {
+			if err := checkBulkTagLimit(tx, req); err != nil {
+				return err
+			}
+		}
+		for _, t := range uniqueTags(req.Add) {
+			err := collectIDs(tx, updated,
+				`UPDATE `+notesTable+` SET tags = array_append(tags, $2), updated_at = $3
+				WHERE id = ANY($1) AND NOT ($2 = ANY(tags)) AND deleted_at IS NULL RETURNING id`,
+				pq.Array(req.IDs), t, clock.Now())
+			if err != nil {
+				return err
+			}
+		}
+		for _, t := range uniqueTags(req.Remove) {
+			err := collectIDs(tx, updated,
+				`UPDATE `+notesTable+` SET tags = array_remove(tags, $2), updated_at = $3
+				WHERE id = ANY($1) AND $2 = ANY(tags) AND deleted_at IS NULL RETURNING id`,
+				pq.Array(req.IDs), t, clock.Now())
+			if err != nil {
+				return err
+			}
+		}
+		return requestActor(r).audit(tx, "update", sortedIDs(updated)...)
+	})
+	var tooMany tooManyTagsError
+	if errors.As(err, &tooMany) {
+		writeValidationErrors(w, validationErrors{"add": tooMany.Error()})
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	notesChanged()
+	writeJSON(w, http.StatusOK, map[string]int{"updated": len(updated)})
+}
+
+// checkBulkTagLimit fails with tooManyTagsError if req would leave any of
+// its live notes with more than maxTags tags. Notes already over the limit
+// are only refused if the request adds to their count.
+func checkBulkTagLimit(tx *sql.Tx, req bulkTagRequest) error {
+	over := map[int64]bool{}
+	err := collectIDs(tx, over, `
+		SELECT n.id FROM `+notesTable+` n,
+			LATERAL (SELECT COUNT(DISTINCT t) AS after FROM unnest(n.tags || $2::text[]) AS t WHERE NOT t = ANY($3::text[])) m
+		WHERE n.id = ANY($1) AND n.deleted_at IS NULL AND m.after > $4 AND m.after > cardinality(n.tags)`,
+		pq.Array(req.IDs), pq.Array(uniqueTags(req.Add)), pq.Array(uniqueTags(req.Remove)), maxTags)
+	if err != nil {
+		return err
+	}
+	if len(over) > 0 {
+		return tooManyTagsError(sortedIDs(over))
+	}
+	return nil
+}
+
+// tooManyTagsError lists notes a bulk add would push past maxTags.
+type tooManyTagsError []int64
+
+func (e tooManyTagsError) Error() string {
+	return fmt.Sprintf("would exceed %d tags on notes %v", maxTags, []int64(e))
+}
+
+// collectIDs runs a query returning note ids and adds them to set.
+func collectIDs(tx *sql.Tx, set map[int64]bool, query string, args ...any) error {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		set[id] = true
+	}
+	return rows.Err()
+}
+
+func sortedIDs(set map[int64]bool) []int64 {
+	ids := make([]int64, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// lowercaseTags folds tags to lower case on write (LOWERCASE_TAGS), so
+// "Work" and "work" are one tag.
+var lowercaseTags = true
+
+func normalizeTag(t string) string {
+	t = strings.TrimSpace(t)
+	if lowercaseTags {
+		t = strings.ToLower(t)
+	}
+	return t
+}
+
+// uniqueTags normalizes tags, dropping empty ones and duplicates while
+// keeping the first occurrence's position. It never returns nil.
+func uniqueTags(tags []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, t := range tags {
+		t = normalizeTag(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
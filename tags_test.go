@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestUniqueTags(t *testing.T) {
+	tests := []struct {
+		in, want []string
+	}{
+		{[]string{"Work ", "work", "WORK"}, []string{"work"}},
+		{[]string{" home", "Work", "home "}, []string{"home", "work"}},
+		{[]string{"", "  ", "a"}, []string{"a"}},
+		{[]string{"b", "a", "B"}, []string{"b", "a"}},
+		{nil, []string{}},
+	}
+	for _, tt := range tests {
+		if got := uniqueTags(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("uniqueTags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUniqueTagsKeepsCase(t *testing.T) {
+	defer func(v bool) { lowercaseTags = v }(lowercaseTags)
+	lowercaseTags = false
+	got := uniqueTags([]string{"Work ", "work", "Work"})
+	if want := []string{"Work", "work"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueTags = %q, want %q", got, want)
+	}
+}
+
+func TestNormalizeTextDedupesTags(t *testing.T) {
+	n := Note{Title: "t", Tags: []string{"Work ", "work", "WORK"}}
+	if err := normalizeText(&n); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"work"}; !reflect.DeepEqual(n.Tags, want) {
+		t.Errorf("tags = %q, want %q", n.Tags, want)
+	}
+}
+
+func TestBulkTagLimit(t *testing.T) {
+	testDB(t)
+	tags := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = "t" + strconv.Itoa(i)
+		}
+		return out
+	}
+	bulk := func(ids []int64, add, remove []string) int {
+		rec := doJSON(t, handleBulkTag, http.MethodPost, "/api/notes/bulk-tag", map[string]any{"ids": ids, "add": add, "remove": remove})
+		return rec.Code
+	}
+	below := createTestNote(t, Note{Title: "below", Body: "x", Tags: tags(maxTags - 1)})
+	full := createTestNote(t, Note{Title: "full", Body: "x", Tags: tags(maxTags)})
+
+	if code := bulk([]int64{below.ID}, []string{"new"}, nil); code != http.StatusOK {
+		t.Errorf("adding up to the limit: status %d, want 200", code)
+	}
+	if code := bulk([]int64{full.ID}, []string{"t0"}, nil); code != http.StatusOK {
+		t.Errorf("adding a tag already present at the limit: status %d, want 200", code)
+	}
+	if code := bulk([]int64{full.ID}, []string{"extra"}, []string{"t0"}); code != http.StatusOK {
+		t.Errorf("swapping a tag at the limit: status %d, want 200", code)
+	}
+	if code := bulk([]int64{full.ID}, []string{"over"}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("adding one over the limit: status %d, want 422", code)
+	}
+
+	trashed := createTestNote(t, Note{Title: "trashed", Body: "x", Tags: tags(maxTags)})
+	if _, err := db.Exec("UPDATE "+notesTable+" SET deleted_at = NOW() WHERE id = $1", trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+	legacy := createTestNote(t, Note{Title: "legacy", Body: "x"})
+	if _, err := db.Exec("UPDATE "+notesTable+" SET tags = $2 WHERE id = $1", legacy.ID, pq.Array(tags(maxTags+2))); err != nil {
+		t.Fatal(err)
+	}
+	fresh := createTestNote(t, Note{Title: "fresh", Body: "x"})
+	if code := bulk([]int64{fresh.ID, trashed.ID, legacy.ID}, []string{"t1"}, nil); code != http.StatusOK {
+		t.Errorf("trashed or already-over notes that do not grow blocked the add: status %d", code)
+	}
+	if n := countNotes(t, "id = $1 AND 't1' = ANY(tags)", fresh.ID); n != 1 {
+		t.Errorf("tag not added to the live note")
+	}
+}
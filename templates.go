@@ -0,0 +1,269 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// noteTemplate is a reusable starting point for notes. Title, body and tags
+// may contain {{name}} placeholders filled in when a note is created from
+// it; Variables lists them in order of first appearance.
+type noteTemplate struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+	Variables []string  `json:"variables"`
+}
+
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+const templateColumns = "id, name, title, body, tags, created_at"
+
+func scanTemplate(sc rowScanner) (noteTemplate, error) {
+	var t noteTemplate
+	err := sc.Scan(&t.ID, &t.Name, &t.Title, &t.Body, pq.Array(&t.Tags), &t.CreatedAt)
+	if t.Tags == nil {
+		t.Tags = []string{}
+	}
+	t.Variables = templateVariables(t)
+	return t, err
+}
+
+func templateVariables(t noteTemplate) []string {
+	vars := []string{}
+	seen := map[string]bool{}
+	for _, s := range append([]string{t.Title, t.Body}, t.Tags...) {
+		for _, m := range placeholderRe.FindAllStringSubmatch(s, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				vars = append(vars, m[1])
+			}
+		}
+	}
+	return vars
+}
+
+// fillPlaceholders substitutes vars into s. Placeholders without a value
+// are left as written.
+func fillPlaceholders(s string, vars map[string]string) string {
+	return placeholderRe.ReplaceAllStringFunc(s, func(m string) string {
+		if v, ok := vars[placeholderRe.FindStringSubmatch(m)[1]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+func validateTemplate(t *noteTemplate) validationErrors {
+	errs := validationErrors{}
+	if strings.TrimSpace(t.Name) == "" {
+		errs["name"] = "required"
+	}
+	if utf8.RuneCountInString(t.Title) > maxTitleLength {
+		errs["title"] = fmt.Sprintf("too long (max %d characters)", maxTitleLength)
+	}
+	if utf8.RuneCountInString(t.Body) > maxBodyLength {
+		errs["body"] = fmt.Sprintf("too long (max %d characters)", maxBodyLength)
+	}
+	if t.Tags == nil {
+		t.Tags = []string{}
+	}
+	return errs
+}
+
+// handleTemplates serves GET (list) and POST (create) on /api/templates.
+func handleTemplates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		defer observeQuery("list", time.Now())
+		var out []noteTemplate
+		err := retry(func() error {
+			out = []noteTemplate{}
+			rows, err := db.Query("SELECT " + templateColumns + " FROM note_templates ORDER BY name, id")
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				t, err := scanTemplate(rows)
+				if err != nil {
+					return err
+				}
+				out = append(out, t)
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, out)
+	case http.MethodPost:
+		var in noteTemplate
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errs := validateTemplate(&in); len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		defer observeQuery("create", time.Now())
+		t, err := scanTemplate(db.QueryRow(
+			"INSERT INTO note_templates (name, title, body, tags, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING "+templateColumns,
+			in.Name, in.Title, in.Body, pq.Array(in.Tags), clock.Now()))
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/api/templates/"+strconv.FormatInt(t.ID, 10))
+		writeJSON(w, http.StatusCreated, t)
+	default:
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTemplateByID serves GET, PUT and DELETE on /api/templates/{id}.
+// GET includes the template's variables so a UI can prompt for them.
+func handleTemplateByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.Trim(r.URL.Path[len("/api/templates/"):], "/"), 10, 64)
+	if err != nil {
+		apiError(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var t noteTemplate
+	switch r.Method {
+	case http.MethodGet:
+		defer observeQuery("get", time.Now())
+		err = retry(func() error {
+			var err error
+			t, err = scanTemplate(db.QueryRow("SELECT "+templateColumns+" FROM note_templates WHERE id = $1", id))
+			return err
+		})
+	case http.MethodPut:
+		var in noteTemplate
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errs := validateTemplate(&in); len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		defer observeQuery("update", time.Now())
+		t, err = scanTemplate(db.QueryRow(
+			"UPDATE note_templates SET name = $2, title = $3, body = $4, tags = $5 WHERE id = $1 RETURNING "+templateColumns,
+			id, in.Name, in.Title, in.Body, pq.Array(in.Tags)))
+	case http.MethodDelete:
+		defer observeQuery("delete", time.Now())
+		if _, err := db.Exec("DELETE FROM note_templates WHERE id = $1", id); err != nil {
+			serverError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// handleFromTemplate serves POST /api/notes/from-template with
+// {"template_id": n, "variables": {"name": "value"}}. It creates a note
+// from the template and reports, as "unfilled", the variables that had no
+// value; their placeholders stay in the note as written.
+func handleFromTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		TemplateID int64             `json:"template_id"`
+		Variables  map[string]string `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var t noteTemplate
+	err := retry(func() error {
+		var err error
+		t, err = scanTemplate(db.QueryRow("SELECT "+templateColumns+" FROM note_templates WHERE id = $1", req.TemplateID))
+		return err
+	})
+	if err == sql.ErrNoRows {
+		apiError(w, "template not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	unfilled := []string{}
+	for _, v := range t.Variables {
+		if _, ok := req.Variables[v]; !ok {
+			unfilled = append(unfilled, v)
+		}
+	}
+	n := Note{
+		Title: fillPlaceholders(t.Title, req.Variables),
+		Body:  fillPlaceholders(t.Body, req.Variables),
+	}
+	for _, tag := range t.Tags {
+		n.Tags = append(n.Tags, fillPlaceholders(tag, req.Variables))
+	}
+	atts, err := prepareNote(&n)
+	var verrs validationErrors
+	if errors.As(err, &verrs) {
+		writeValidationErrors(w, verrs)
+		return
+	}
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer observeQuery("create", time.Now())
+	var out Note
+	err = withTx(func(tx *sql.Tx) error {
+		var err error
+		if out, err = insertNote(tx, n, atts); err != nil {
+			return err
+		}
+		return requestActor(r).audit(tx, "create", out.ID)
+	})
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	notesChanged()
+	publishNote("created", out)
+	w.Header().Set("Location", "/api/notes/"+noteRef(out))
+	note, err := renderNote(r, out, nil)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"note": note, "unfilled": unfilled})
+}
@@ -0,0 +1,74 @@
+package main
+
+import "unicode"
+
+// truncateRunes returns the first n runes of s. It never splits a multibyte
+// character.
+func truncateRunes(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos]
+		}
+		i++
+	}
+	return s
+}
+
+// truncateGraphemes returns the first n user-perceived characters of s. It
+// approximates grapheme clusters: combining marks, variation selectors,
+// emoji skin-tone modifiers, zero-width-joiner sequences, regional
+// indicator pairs (flags) and decomposed Hangul vowels and finals stay
+// attached to the preceding character.
+func truncateGraphemes(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	count := 0
+	prev := rune(-1)
+	riRun := 0
+	for pos, r := range s {
+		extends := prev >= 0 && (isGraphemeExtend(r) || prev == zwj ||
+			(isRegionalIndicator(r) && isRegionalIndicator(prev) && riRun%2 == 1))
+		if isRegionalIndicator(r) {
+			riRun++
+		} else {
+			riRun = 0
+		}
+		if !extends {
+			if count == n {
+				return s[:pos]
+			}
+			count++
+		}
+		prev = r
+	}
+	return s
+}
+
+// excerpt shortens s to at most n characters, marking the cut with an ellipsis.
+func excerpt(s string, n int) string {
+	t := truncateGraphemes(s, n)
+	if len(t) == len(s) {
+		return s
+	}
+	return t + "…"
+}
+
+const zwj = '\u200d'
+
+func isGraphemeExtend(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		r == zwj ||
+		(r >= 0xFE00 && r <= 0xFE0F) || // variation selectors
+		(r >= 0x1F3FB && r <= 0x1F3FF) || // skin-tone modifiers
+		(r >= 0xE0020 && r <= 0xE007F) || // tag characters
+		(r >= 0x1160 && r <= 0x11FF) || (r >= 0xD7B0 && r <= 0xD7FF) // Hangul jamo vowels and finals
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"hello", 3, "hel"},
+		{"hello", 5, "hello"},
+		{"hello", 10, "hello"},
+		{"hello", 0, ""},
+		{"hello", -1, ""},
+		{"日本語のテキスト", 3, "日本語"},
+		{"héllo", 2, "hé"},
+		{"a\U0001F600b", 2, "a\U0001F600"},
+	}
+	for _, tt := range tests {
+		got := truncateRunes(tt.in, tt.n)
+		if got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateRunes(%q, %d) = %q is not valid UTF-8", tt.in, tt.n, got)
+		}
+	}
+}
+
+func TestTruncateGraphemes(t *testing.T) {
+	tests := []struct {
+		name, in string
+		n        int
+		want     string
+	}{
+		{"ascii", "hello", 3, "hel"},
+		{"shorter than n", "hi", 5, "hi"},
+		{"zero", "hello", 0, ""},
+		{"CJK", "日本語のテキスト", 4, "日本語の"},
+		{"CJK at end", "日本語", 3, "日本語"},
+		{"precomposed", "\u00e9\u00e9\u00e9", 2, "\u00e9\u00e9"},
+		{"combining acute", "e\u0301e\u0301e\u0301", 2, "e\u0301e\u0301"},
+		{"stacked combining marks", "a\u0323\u0308b", 1, "a\u0323\u0308"},
+		{"Devanagari vowel sign", "\u0915\u093f\u0916", 1, "\u0915\u093f"},
+		{"Hangul jamo", "\u1100\u1161\u11a8x", 1, "\u1100\u1161\u11a8"},
+		{"emoji", "\U0001F600\U0001F603\U0001F604", 2, "\U0001F600\U0001F603"},
+		{"variation selector", "\u2764\ufe0f\u2764\ufe0f", 1, "\u2764\ufe0f"},
+		{"skin tone", "\U0001F44D\U0001F3FD\U0001F44D\U0001F3FD", 1, "\U0001F44D\U0001F3FD"},
+		{"ZWJ family", "\U0001F468\u200d\U0001F469\u200d\U0001F467x", 1, "\U0001F468\u200d\U0001F469\u200d\U0001F467"},
+		{"flags", "\U0001F1EF\U0001F1F5\U0001F1EB\U0001F1F7\U0001F1E9\U0001F1EA", 2, "\U0001F1EF\U0001F1F5\U0001F1EB\U0001F1F7"},
+		{"odd regional indicators", "\U0001F1EF\U0001F1F5\U0001F1EB", 1, "\U0001F1EF\U0001F1F5"},
+		{"tag sequence", "\U0001F3F4\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007Fx", 1, "\U0001F3F4\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateGraphemes(tt.in, tt.n); got != tt.want {
+				t.Errorf("truncateGraphemes(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	if got := excerpt("étude", 1); got != "é…" {
+		t.Errorf("excerpt = %q, want %q", got, "é…")
+	}
+	if got := excerpt("short", 10); got != "short" {
+		t.Errorf("excerpt = %q, want unchanged", got)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trashRetention is how long trashed notes are kept before the janitor
+// purges them; 0 disables the janitor.
+var trashRetention time.Duration
+
+// parseAge parses a duration that may use day and week units in addition to
+// those of time.ParseDuration, e.g. "30d", "2w", "1d12h".
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	var total time.Duration
+	for _, unit := range []struct {
+		suffix string
+		d      time.Duration
+	}{{"w", 7 * 24 * time.Hour}, {"d", 24 * time.Hour}} {
+		i := strings.Index(s, unit.suffix)
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.Atoi(s[:i])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += time.Duration(n) * unit.d
+		s = s[i+1:]
+	}
+	if s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += d
+	}
+	return total, nil
+}
+
+// purgeTrash permanently deletes notes trashed more than olderThan ago.
+func purgeTrash(a actor, olderThan time.Duration, dryRun bool) ([]int64, error) {
+	defer observeQuery("delete", time.Now())
+	now := clock.Now()
+	var ids []int64
+	err := dryRunTx(dryRun, func(tx *sql.Tx) error {
+		var err error
+		ids, err = collectDeleted(tx,
+			logDeletes("DELETE FROM "+notesTable+" WHERE deleted_at IS NOT NULL AND deleted_at <= $1 RETURNING id", 2),
+			now.Add(-olderThan), now)
+		if err != nil {
+			return err
+		}
+		return a.audit(tx, "delete", ids...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 && !dryRun {
+		notesChanged()
+	}
+	return ids, nil
+}
+
+// handlePurgeTrash serves POST /api/notes/purge-trash?older_than=30d. The
+// threshold defaults to TRASH_RETENTION when set. With dry_run=true nothing
+// is deleted and the ids that would be are listed instead.
+func handlePurgeTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	olderThan := trashRetention
+	if v := r.URL.Query().Get("older_than"); v != "" {
+		d, err := parseAge(v)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		olderThan = d
+	} else if olderThan == 0 {
+		apiError(w, "older_than required", http.StatusBadRequest)
+		return
+	}
+	ids, err := purgeTrash(requestActor(r), olderThan, isDryRun(r))
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if isDryRun(r) {
+		writeJSON(w, http.StatusOK, map[string]any{"purged": len(ids), "ids": ids, "dry_run": true})
+		return
+	}
+	analyzeNotes("purge", len(ids))
+	writeJSON(w, http.StatusOK, map[string]int{"purged": len(ids)})
+}
+
+// handleEmptyTrash serves DELETE /api/notes/trash, permanently deleting
+// every trashed note. dry_run=true lists them instead.
+func handleEmptyTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ids, err := purgeTrash(requestActor(r), 0, isDryRun(r))
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if isDryRun(r) {
+		writeJSON(w, http.StatusOK, map[string]any{"deleted": len(ids), "ids": ids, "dry_run": true})
+		return
+	}
+	analyzeNotes("purge", len(ids))
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": len(ids)})
+}
+
+// trashJanitor purges expired trash every interval.
+func trashJanitor(interval time.Duration) {
+	for range time.Tick(interval) {
+		if readOnly.Load() {
+			continue
+		}
+		ids, err := purgeTrash(systemActor, trashRetention, false)
+		if err != nil {
+			log.Println("trash janitor:", err)
+			continue
+		}
+		if len(ids) > 0 {
+			log.Printf("trash janitor: purged %d notes", len(ids))
+			analyzeNotes("purge", len(ids))
+		}
+	}
+}
+
+// addPurgeTimes sets when each trashed note in notes will be purged by the
+// janitor, and how many seconds remain until then. It does nothing when
+// trash is kept indefinitely.
+func addPurgeTimes(notes []Note) {
+	if trashRetention <= 0 {
+		return
+	}
+	now := clock.Now()
+	for i := range notes {
+		if notes[i].DeletedAt == nil {
+			continue
+		}
+		at := notes[i].DeletedAt.Add(trashRetention)
+		left := int64(max(at.Sub(now), 0) / time.Second)
+		notes[i].PurgeAt, notes[i].UntilPurge = &at, &left
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+const maxExternalIDLength = 255
+
+// scanExtra scans a note row followed by extra columns.
+type scanExtra struct {
+	rowScanner
+	extra []any
+}
+
+func (s scanExtra) Scan(dest ...any) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
+
+// upsertNote creates n, or overwrites the note already holding its
+// external_id, so a sync client can resend its notes without duplicating
+// them. out.Upsert says which happened. Attachments are added as on update,
+// and a trashed note stays in the trash.
+func upsertNote(tx *sql.Tx, n Note, atts []attachmentData) (Note, error) {
+	if n.Pinned {
+		var existing int64
+		err := tx.QueryRow("SELECT id FROM "+notesTable+" WHERE external_id = $1", *n.ExternalID).Scan(&existing)
+		if err != nil && err != sql.ErrNoRows {
+			return Note{}, err
+		}
+		if err := checkPinLimit(tx, existing); err != nil {
+			return Note{}, err
+		}
+	}
+	if err := saveRevision(tx, "external_id = $1", *n.ExternalID, n.Title, n.Body); err != nil {
+		return Note{}, err
+	}
+	var inserted bool
+	row := tx.QueryRow(`
+		INSERT INTO `+notesTable+` (title, body, tags, pinned, pin_position, public, content_json, metadata, created_at, updated_at, external_id, notebook_id, publish_at, language, export_format, format)
+		VALUES ($1, $2, $3, $4, CASE WHEN $4 THEN $5::BIGINT END, $6, $7::jsonb, $8::jsonb, $9, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (external_id) DO UPDATE SET title = EXCLUDED.title, body = EXCLUDED.body,
+			tags = EXCLUDED.tags, pinned = EXCLUDED.pinned, pin_position = EXCLUDED.pin_position,
+			public = EXCLUDED.public, content_json = EXCLUDED.content_json,
+			metadata = EXCLUDED.metadata, updated_at = EXCLUDED.updated_at,
+			notebook_id = EXCLUDED.notebook_id, publish_at = EXCLUDED.publish_at,
+			language = EXCLUDED.language, export_format = EXCLUDED.export_format, format = EXCLUDED.format,
+			notebook_pinned = `+notesTable+`.notebook_pinned AND `+notesTable+`.notebook_id IS NOT DISTINCT FROM EXCLUDED.notebook_id
+		RETURNING `+noteColumns+`, xmax = 0`,
+		n.Title, n.Body, pq.Array(n.Tags), n.Pinned, n.PinPosition, n.Public,
+		nullableJSON(n.ContentJSON), n.Metadata, clock.Now(), *n.ExternalID, n.NotebookID, n.PublishAt, n.Language, n.ExportFormat, n.Format,
+	)
+	out, err := scanNote(scanExtra{row, []any{&inserted}})
+	if err != nil {
+		return Note{}, err
+	}
+	out.Upsert = "updated"
+	if inserted {
+		out.Upsert = "created"
+	}
+	return finishInsert(tx, out, atts)
+}
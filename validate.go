@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+var (
+	maxTitleLength = 200
+	maxBodyLength  = 100000
+	// softBodyLength is a length past which notes are still saved but come
+	// back with a warning; 0 disables it.
+	softBodyLength = 0
+	maxTags        = 20
+	maxTagLength   = 50
+)
+
+// validationErrors maps a field name to what is wrong with it.
+type validationErrors map[string]string
+
+func validateNote(n *Note) validationErrors {
+	errs := validationErrors{}
+	if utf8.RuneCountInString(n.Title) > maxTitleLength {
+		errs["title"] = fmt.Sprintf("too long (max %d characters)", maxTitleLength)
+	}
+	if utf8.RuneCountInString(n.Body) > maxBodyLength {
+		errs["body"] = fmt.Sprintf("too long (max %d characters)", maxBodyLength)
+	}
+	if strings.TrimSpace(n.Title) == "" && strings.TrimSpace(n.Body) == "" {
+		errs["body"] = "required when title is empty"
+	}
+	if n.ExportFormat != nil && exportFormats[*n.ExportFormat] == nil {
+		errs["export_format"] = "must be one of " + exportFormatNames()
+	}
+	if noteFormats[n.Format] == nil {
+		errs["format"] = "must be one of " + noteFormatNames
+	}
+	if msg := validateLanguage(n.Language); msg != "" {
+		errs["language"] = msg
+	}
+	if msg := validateTags(n.Tags); msg != "" {
+		errs["tags"] = msg
+	}
+	if msg := validateMetadata(n.Metadata); msg != "" {
+		errs["metadata"] = msg
+	}
+	if id := n.ExternalID; id != nil && (*id == "" || len(*id) > maxExternalIDLength) {
+		errs["external_id"] = fmt.Sprintf("must be 1 to %d bytes", maxExternalIDLength)
+	}
+	return errs
+}
+
+func (e validationErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for f := range e {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = f + ": " + e[f]
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+func validateTags(tags []string) string {
+	if len(tags) > maxTags {
+		return fmt.Sprintf("too many tags (max %d)", maxTags)
+	}
+	for _, t := range tags {
+		if utf8.RuneCountInString(t) > maxTagLength {
+			return fmt.Sprintf("tag %q too long (max %d characters)", t, maxTagLength)
+		}
+	}
+	return ""
+}
+
+// noteWarnings lists non-fatal problems with a saved note.
+func noteWarnings(n Note) []string {
+	var w []string
+	if softBodyLength > 0 {
+		if l := utf8.RuneCountInString(n.Body); l > softBodyLength {
+			w = append(w, fmt.Sprintf("body is %d characters, over the suggested %d", l, softBodyLength))
+		}
+	}
+	return w
+}
+
+// writeValidationErrors responds 422 with a per-field error map and a
+// one-line summary for clients that only read "error".
+func writeValidationErrors(w http.ResponseWriter, errs validationErrors) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+		"error":      errs.Error(),
+		"errors":     errs,
+		"request_id": responseRequestID(w),
+	})
+}
+
+// uniqueViolation reports whether err is a unique constraint violation on
+// notes and, if so, the field that collided. Checks made before writing can
+// race with a concurrent write; this turns the loser's error into a 409.
+func uniqueViolation(err error) (string, bool) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return "", false
+	}
+	field := strings.TrimPrefix(pqErr.Constraint, notesTable+"_")
+	field = strings.TrimSuffix(strings.TrimSuffix(field, "_key"), "_idx")
+	return field, true
+}
+
+func writeConflict(w http.ResponseWriter, field string) {
+	writeJSON(w, http.StatusConflict, map[string]any{
+		"error":      field + " already in use",
+		"field":      field,
+		"request_id": responseRequestID(w),
+	})
+}
+
+// handleValidate serves POST /api/notes/validate: the checks create and
+// update run, without writing anything. It answers {"valid": true} with any
+// warnings, or 422 with the same error map a save would return.
+func handleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var n Note
+	if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+		apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if n.Tags == nil {
+		n.Tags = []string{}
+	}
+	errs := validationErrors{}
+	if err := applyContentJSON(&n); err != nil {
+		errs["content_json"] = err.Error()
+	}
+	var verrs validationErrors
+	if err := normalizeText(&n); errors.As(err, &verrs) {
+		for field, msg := range verrs {
+			errs[field] = msg
+		}
+	} else if err != nil {
+		for field, ok := range map[string]bool{
+			"title": utf8.ValidString(n.Title),
+			"body":  utf8.ValidString(n.Body),
+			"tags":  utf8.ValidString(strings.Join(n.Tags, "")),
+		} {
+			if !ok {
+				errs[field] = err.Error()
+			}
+		}
+	}
+	for field, msg := range validateNote(&n) {
+		if _, ok := errs[field]; !ok {
+			errs[field] = msg
+		}
+	}
+	if _, err := decodeAttachments(n.Attachments); err != nil {
+		errs["attachments"] = err.Error()
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	resp := map[string]any{"valid": true}
+	if warnings := noteWarnings(n); len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
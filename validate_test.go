@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCreateReportsAllFieldErrors(t *testing.T) {
+	tags := make([]string, maxTags+1)
+	for i := range tags {
+		tags[i] = "tag" + strings.Repeat("x", i)
+	}
+	body, _ := json.Marshal(map[string]any{
+		"title":  strings.Repeat("t", maxTitleLength+1),
+		"body":   "text",
+		"tags":   tags,
+		"format": "rtf",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/notes", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handleNotes(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422; body %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Error  string            `json:"error"`
+		Errors map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	for _, field := range []string{"title", "tags", "format"} {
+		if resp.Errors[field] == "" {
+			t.Errorf("errors has no %q entry: %v", field, resp.Errors)
+		}
+		if !strings.Contains(resp.Error, field) {
+			t.Errorf("summary %q does not mention %q", resp.Error, field)
+		}
+	}
+}
+
+func TestValidateTagsBoundary(t *testing.T) {
+	tags := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = "tag" + strings.Repeat("x", i)
+		}
+		return out
+	}
+	tests := []struct {
+		name    string
+		tags    []string
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"at the limit", tags(maxTags), false},
+		{"one over the limit", tags(maxTags + 1), true},
+		{"longest tag", []string{strings.Repeat("a", maxTagLength)}, false},
+		{"tag one too long", []string{strings.Repeat("a", maxTagLength+1)}, true},
+		{"longest multibyte tag", []string{strings.Repeat("é", maxTagLength)}, false},
+		{"multibyte tag one too long", []string{strings.Repeat("é", maxTagLength+1)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if msg := validateTags(tt.tags); (msg != "") != tt.wantErr {
+				t.Errorf("validateTags = %q, want error %v", msg, tt.wantErr)
+			}
+			n := Note{Title: "t", Tags: tt.tags}
+			_, err := prepareNote(&n)
+			if errs, _ := err.(validationErrors); (errs["tags"] != "") != tt.wantErr {
+				t.Errorf("prepareNote = %v, want tags error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConcurrentCreateSameExternalID(t *testing.T) {
+	testDB(t)
+	const n = 10
+	codes := make([]int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := doJSON(t, handleNotes, http.MethodPost, "/api/notes", map[string]any{
+				"title": "copy", "body": "same note", "external_id": "client-1",
+			})
+			codes[i] = rec.Code
+		}(i)
+	}
+	wg.Wait()
+	for i, code := range codes {
+		switch code {
+		case http.StatusOK, http.StatusCreated, http.StatusConflict:
+		default:
+			t.Errorf("request %d: status %d", i, code)
+		}
+	}
+	if got := countNotes(t, "external_id = $1", "client-1"); got != 1 {
+		t.Errorf("%d rows with the external_id, want 1", got)
+	}
+}
+
+func TestCreateWithBadTagsWritesNothing(t *testing.T) {
+	testDB(t)
+	tags := make([]string, maxTags+1)
+	for i := range tags {
+		tags[i] = "tag" + strings.Repeat("x", i)
+	}
+	rec := doJSON(t, handleNotes, http.MethodPost, "/api/notes", map[string]any{
+		"title": "tagged", "body": "links to [[Other]]", "tags": tags,
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status %d, want 422", rec.Code)
+	}
+	if n := countNotes(t, "true"); n != 0 {
+		t.Errorf("%d notes after a rejected create, want 0", n)
+	}
+
+	// A failure raised by the database once the row is in must roll back
+	// the insert and everything written with it.
+	_, err := db.Exec(`
+		CREATE OR REPLACE FUNCTION test_reject_tag() RETURNS trigger AS $$
+		BEGIN
+			IF 'reject' = ANY(NEW.tags) THEN RAISE EXCEPTION 'tag rejected'; END IF;
+			RETURN NEW;
+		END $$ LANGUAGE plpgsql`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TRIGGER test_reject_tag AFTER INSERT ON " + notesTable + " FOR EACH ROW EXECUTE FUNCTION test_reject_tag()"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP TRIGGER IF EXISTS test_reject_tag ON " + notesTable)
+		db.Exec("DROP FUNCTION IF EXISTS test_reject_tag()")
+	})
+	rec = doJSON(t, handleNotes, http.MethodPost, "/api/notes", map[string]any{
+		"title": "tagged", "body": "links to [[Other]]", "tags": []string{"work", "reject"},
+	})
+	if rec.Code < 400 {
+		t.Errorf("status %d, want an error", rec.Code)
+	}
+	if n := countNotes(t, "true"); n != 0 {
+		t.Errorf("%d notes after a failed create, want 0", n)
+	}
+	var links int
+	if err := db.QueryRow("SELECT COUNT(*) FROM note_links").Scan(&links); err != nil {
+		t.Fatal(err)
+	}
+	if links != 0 {
+		t.Errorf("%d links left by a failed create, want 0", links)
+	}
+}
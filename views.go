@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// savedView is a named list query: filters are list parameters such as
+// tag, notebook or q, and sort is one of the list sorts.
+type savedView struct {
+	ID        int64             `json:"id"`
+	Name      string            `json:"name"`
+	Filters   map[string]string `json:"filters"`
+	Sort      string            `json:"sort,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+const maxViewName = 100
+
+// viewFilters are the list parameters a view may save. Pagination and
+// output options are left to each request.
+var viewFilters = map[string]bool{
+	"tag": true, "notebook": true, "q": true, "search_fields": true, "prefix": true,
+	"language": true, "created_after": true, "created_before": true,
+	"include_scheduled": true, "include_snoozed": true, "include_revisions": true, "trashed": true, "ignore_pins": true,
+}
+
+const viewColumns = "id, name, filters, sort, created_at"
+
+func scanView(sc rowScanner) (savedView, error) {
+	var v savedView
+	var filters []byte
+	if err := sc.Scan(&v.ID, &v.Name, &filters, &v.Sort, &v.CreatedAt); err != nil {
+		return v, err
+	}
+	err := json.Unmarshal(filters, &v.Filters)
+	return v, err
+}
+
+// query returns the list parameters of v.
+func (v savedView) query() url.Values {
+	qs := url.Values{}
+	for k, val := range v.Filters {
+		qs.Set(k, val)
+	}
+	if v.Sort != "" {
+		qs.Set("sort", v.Sort)
+	}
+	return qs
+}
+
+func validateView(v *savedView) validationErrors {
+	errs := validationErrors{}
+	v.Name = strings.TrimSpace(v.Name)
+	if v.Name == "" {
+		errs["name"] = "required"
+	} else if utf8.RuneCountInString(v.Name) > maxViewName {
+		errs["name"] = "too long (max " + strconv.Itoa(maxViewName) + " characters)"
+	}
+	if v.Filters == nil {
+		v.Filters = map[string]string{}
+	}
+	var unknown []string
+	for k := range v.Filters {
+		if !viewFilters[k] && !strings.HasPrefix(k, "meta.") {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		errs["filters"] = "unknown parameters: " + strings.Join(unknown, ", ")
+	} else if _, err := listFilters(&http.Request{URL: &url.URL{RawQuery: v.query().Encode()}}); err != nil {
+		errs["filters"] = err.Error()
+	}
+	if _, ok := sortOrders[v.Sort]; v.Sort != "" && !ok {
+		errs["sort"] = "unknown sort"
+	}
+	return errs
+}
+
+// handleViews serves GET (list) and POST (create) on /api/views.
+func handleViews(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		defer observeQuery("list", time.Now())
+		var out []savedView
+		err := retry(func() error {
+			out = []savedView{}
+			rows, err := db.Query("SELECT " + viewColumns + " FROM saved_views ORDER BY name, id")
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				v, err := scanView(rows)
+				if err != nil {
+					return err
+				}
+				out = append(out, v)
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, out)
+	case http.MethodPost:
+		var in savedView
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errs := validateView(&in); len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		filters, _ := json.Marshal(in.Filters)
+		defer observeQuery("create", time.Now())
+		v, err := scanView(db.QueryRow(
+			"INSERT INTO saved_views (name, filters, sort, created_at) VALUES ($1, $2, $3, $4) RETURNING "+viewColumns,
+			in.Name, filters, in.Sort, clock.Now()))
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/api/views/"+strconv.FormatInt(v.ID, 10))
+		writeJSON(w, http.StatusCreated, v)
+	default:
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleViewByID serves GET, PUT and DELETE on /api/views/{id}, and
+// GET /api/views/{id}/notes: the list endpoint run with the view's
+// parameters. Parameters on the request itself, such as limit, are added
+// and take precedence.
+func handleViewByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path[len("/api/views/"):], "/"), "/")
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) > 2 || (len(parts) == 2 && parts[1] != "notes") {
+		notFound(w, r)
+		return
+	}
+	var v savedView
+	switch {
+	case len(parts) == 2:
+		if r.Method != http.MethodGet {
+			apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		err = retry(func() error {
+			var err error
+			v, err = scanView(db.QueryRow("SELECT "+viewColumns+" FROM saved_views WHERE id = $1", id))
+			return err
+		})
+		if err == nil {
+			qs := v.query()
+			for k, vals := range r.URL.Query() {
+				qs[k] = vals
+			}
+			lr := r.Clone(r.Context())
+			lr.URL.RawQuery = qs.Encode()
+			listNotes(w, lr)
+			return
+		}
+	case r.Method == http.MethodGet:
+		defer observeQuery("get", time.Now())
+		err = retry(func() error {
+			var err error
+			v, err = scanView(db.QueryRow("SELECT "+viewColumns+" FROM saved_views WHERE id = $1", id))
+			return err
+		})
+	case r.Method == http.MethodPut:
+		var in savedView
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			apiError(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errs := validateView(&in); len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		filters, _ := json.Marshal(in.Filters)
+		defer observeQuery("update", time.Now())
+		v, err = scanView(db.QueryRow(
+			"UPDATE saved_views SET name = $2, filters = $3, sort = $4 WHERE id = $1 RETURNING "+viewColumns,
+			id, in.Name, filters, in.Sort))
+	case r.Method == http.MethodDelete:
+		defer observeQuery("delete", time.Now())
+		if _, err := db.Exec("DELETE FROM saved_views WHERE id = $1", id); err != nil {
+			serverError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		apiError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err == sql.ErrNoRows {
+		apiError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}